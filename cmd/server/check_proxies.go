@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"github.com/Dissociable/Couploan/ent/proxy"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runCheckProxies checks the proxies of a file or of the proxies table and writes a report of the results
+//
+//	server check-proxies [-file proxies.txt] [-concurrency 10] [-timeout 30s] [-target url] [-exit]
+//	                     [-output report.csv] [-format json|csv] [-disable]
+func runCheckProxies(ctx context.Context, args []string) (err error) {
+	c = services.NewContainer()
+
+	fs := flag.NewFlagSet("check-proxies", flag.ContinueOnError)
+	file := fs.String("file", "", "file of the proxies, one per line, defaults to the proxies table")
+	protocol := fs.String("protocol", string(proxstore.ProtocolHttp), "protocol of the lines without one")
+	concurrency := fs.Int("concurrency", 10, "number of proxies checked at once")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of checking a single proxy")
+	target := fs.String("target", "", "url requested through the proxies, defaults to the health check of the target")
+	resolveExit := fs.Bool(
+		"exit", false, "resolve the exit ip of the working proxies, failing the ones exiting from another country",
+	)
+	output := fs.String("output", "-", "report file, - for stdout")
+	format := fs.String("format", "", "report format, json or csv, defaults to the extension of the output")
+	disable := fs.Bool("disable", false, "mark the failed proxies of the proxies table as disabled")
+	if err = fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *disable && *file != "" {
+		return errors.New("-disable only applies to the proxies table")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*output), ".")
+		if *format != "csv" {
+			*format = "json"
+		}
+	}
+
+	var (
+		proxies []*proxstore.Proxy[tls_client.HttpClient]
+		ids     []int
+	)
+	if *file != "" {
+		proxies, err = readProxiesFile(*file, proxstore.Protocol(*protocol))
+	} else {
+		proxies, ids, err = queryProxies(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	c.Logger.Info("Checking proxies", zap.Int("count", len(proxies)))
+
+	results := ve.CheckProxies(
+		ctx, proxies, &ve.ProxyCheckOptions{
+			Profile:     c.TargetProfile,
+			Target:      *target,
+			Timeout:     *timeout,
+			Concurrency: *concurrency,
+			ResolveExit: *resolveExit,
+			IPResolver:  ve.NewEchoIPResolver(),
+			GeoIP:       c.GeoIP,
+		},
+	)
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, errCreate := os.Create(*output)
+		if errCreate != nil {
+			return errors.Wrap(errCreate, "failed to create report file")
+		}
+		defer f.Close()
+		w = f
+	}
+	if err = ve.WriteProxyCheckReport(w, *format, results); err != nil {
+		return err
+	}
+
+	var failed []int
+	for i, result := range results {
+		if result.Status == ve.ProxyCheckFailed {
+			failed = append(failed, i)
+		}
+	}
+	c.Logger.Info("Checked proxies", zap.Int("count", len(results)), zap.Int("failed", len(failed)))
+	if *disable && len(failed) > 0 {
+		failedIDs := make([]int, len(failed))
+		for i, index := range failed {
+			failedIDs[i] = ids[index]
+		}
+		n, errUpdate := c.ORM.Proxy.Update().Where(proxy.IDIn(failedIDs...)).SetDisabled(true).Save(ctx)
+		if errUpdate != nil {
+			return errors.Wrap(errUpdate, "failed to disable proxies")
+		}
+		c.Logger.Info("Disabled failed proxies", zap.Int("count", n))
+	}
+	return nil
+}
+
+// readProxiesFile parses the proxies of the file, skipping the empty lines and the ones starting with #
+func readProxiesFile(path string, protocol proxstore.Protocol) (
+	proxies []*proxstore.Proxy[tls_client.HttpClient], err error,
+) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open proxies file")
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, errParse := proxstore.ParseLine[tls_client.HttpClient](line, protocol)
+		if errParse != nil {
+			return nil, errors.Wrapf(errParse, "failed to parse line %d", n)
+		}
+		proxies = append(proxies, p)
+	}
+	return proxies, errors.Wrap(scanner.Err(), "failed to read proxies file")
+}
+
+// queryProxies returns the enabled proxies of the proxies table and their ids
+func queryProxies(ctx context.Context) (proxies []*proxstore.Proxy[tls_client.HttpClient], ids []int, err error) {
+	rows, err := c.ORM.Proxy.Query().Where(proxy.Disabled(false)).WithProxyProvider().All(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to query proxies")
+	}
+	providers := make(map[int]*proxstore.Provider)
+	for _, row := range rows {
+		proxies = append(proxies, proxyFromEnt(row, providers))
+		ids = append(ids, row.ID)
+	}
+	return proxies, ids, nil
+}
@@ -13,7 +13,6 @@ import (
 	"github.com/Dissociable/Couploan/pkg/services"
 	"github.com/Dissociable/Couploan/pkg/tasks"
 	"github.com/Dissociable/Couploan/proxstore"
-	"github.com/Dissociable/Couploan/ve"
 	tls_client "github.com/bogdanfinn/tls-client"
 	"github.com/brianvoe/gofakeit/v7"
 	"github.com/pkg/errors"
@@ -49,7 +48,10 @@ func main() {
 	}
 }
 
-func run(ctx context.Context, _ []string) error {
+func run(ctx context.Context, args []string) error {
+	if len(args) > 1 && args[1] == "check-proxies" {
+		return runCheckProxies(ctx, args[2:])
+	}
 	for {
 		select {
 		case <-ctx.Done():
@@ -81,41 +83,31 @@ func runMain(ctx context.Context) (err error) {
 	c.Logger.Info("Loaded proxies", zap.Int("count", c.ProxyStore.Count()))
 
 	if c.Config.App.Environment == config.EnvLocal || c.Config.App.Environment == config.EnvDevelop {
-		p := c.ProxyStore.Next()
-		v := ve.New(c.Config, c.ProxyStore, p)
-		// for i := 0; i < 6; i++ {
-		// 	ip, err := v.IP(ctx)
-		// 	if err != nil {
-		// 		c.Logger.Error("failed to get IP", zap.Error(err))
-		// 		return err
-		// 	}
-		// 	c.Logger.Info("IP", zap.String("ip", ip))
-		// 	released, err := c.ProxyStore.ReleaseProxy(p)
-		// 	if err != nil {
-		// 		c.Logger.Error("failed to release proxy", zap.Error(err))
-		// 		return err
-		// 	}
-		// 	if !released {
-		// 		c.Logger.Fatal("failed to released proxy", zap.String("proxy", p.String()))
-		// 	}
-		// }
-		ip, err := v.IP(ctx)
+		// The session is warmed up by loading the index
+		session, err := c.SessionPool.Get(ctx)
 		if err != nil {
-			c.Logger.Error("failed to get IP", zap.Error(err))
+			c.Logger.Error("failed to get session", zap.Error(err))
 			return err
 		}
-		c.Logger.Info("IP", zap.String("ip", ip))
-		_, err = v.Index(ctx)
+		c.Logger.Debug("got index successfully")
+		ip, err := session.IP(ctx)
+		session.Release(err)
 		if err != nil {
-			c.Logger.Error("failed to get index", zap.Error(err))
+			c.Logger.Error("failed to get IP", zap.Error(err))
 			return err
-		} else {
-			c.Logger.Debug("got index successfully")
 		}
+		c.Logger.Info("IP", zap.String("ip", ip))
 	}
 
 	// Start the scheduler service to queue periodic tasks
-	tasks.StartTasksRunner(c, true)
+	if _, err = tasks.StartTasksRunner(ctx, c); err != nil {
+		c.Logger.Error("failed to start tasks runner", zap.Error(err))
+		return err
+	}
+	if _, err = tasks.StartScheduler(ctx, c); err != nil {
+		c.Logger.Error("failed to start tasks scheduler", zap.Error(err))
+		return err
+	}
 
 	// Start the bot
 	routes.BuildRouter(c)
@@ -125,7 +117,7 @@ func runMain(ctx context.Context) (err error) {
 
 func loadProxies(ctx context.Context, container *services.Container) (err error) {
 	providers := make(map[int]*proxstore.Provider)
-	proxies, err := c.ORM.Proxy.Query().WithProxyProvider().All(ctx)
+	proxies, err := c.ORM.Proxy.Query().Where(proxy.Disabled(false)).WithProxyProvider().All(ctx)
 	if err != nil {
 		if ent.IsNotFound(err) {
 			err = nil
@@ -135,39 +127,7 @@ func loadProxies(ctx context.Context, container *services.Container) (err error)
 		return
 	}
 	for _, p := range proxies {
-		var prox *proxstore.Proxy[tls_client.HttpClient]
-		if p.Username != nil && p.Password != nil {
-			prox = proxstore.NewProxyWithCredential[tls_client.HttpClient](
-				p.IP,
-				p.Port,
-				proxstore.Protocol(strings.ToLower(string(p.Type))),
-				*p.Username,
-				*p.Password,
-			)
-		} else {
-			prox = proxstore.NewProxy[tls_client.HttpClient](
-				p.IP,
-				p.Port,
-				proxstore.Protocol(strings.ToLower(string(p.Type))),
-			)
-		}
-		if p.Edges.ProxyProvider != nil {
-			existingProvider, ok := providers[p.Edges.ProxyProvider.ID]
-			if !ok {
-				existingProvider = &proxstore.Provider{
-					Name:        proxstore.ProviderName(p.Edges.ProxyProvider.Name),
-					ServiceType: p.Edges.ProxyProvider.ServiceType,
-					Username:    p.Edges.ProxyProvider.Username,
-					Password:    p.Edges.ProxyProvider.Password,
-				}
-				providers[p.Edges.ProxyProvider.ID] = existingProvider
-			}
-			prox = prox.SetProvider(existingProvider)
-		}
-		if p.Rotating {
-			prox.Rotating = true
-		}
-
+		prox := proxyFromEnt(p, providers)
 		err = container.ProxyStore.LoadProxy(prox)
 		if err != nil {
 			err = errors.Wrapf(err, "failed to load proxy: %s", prox.String())
@@ -178,6 +138,46 @@ func loadProxies(ctx context.Context, container *services.Container) (err error)
 	return nil
 }
 
+// proxyFromEnt creates the proxy of the row, sharing the providers between the proxies via providers
+func proxyFromEnt(p *ent.Proxy, providers map[int]*proxstore.Provider) *proxstore.Proxy[tls_client.HttpClient] {
+	var prox *proxstore.Proxy[tls_client.HttpClient]
+	if p.Username != nil && p.Password != nil {
+		prox = proxstore.NewProxyWithCredential[tls_client.HttpClient](
+			p.IP,
+			p.Port,
+			proxstore.Protocol(strings.ToLower(string(p.Type))),
+			*p.Username,
+			*p.Password,
+		)
+	} else {
+		prox = proxstore.NewProxy[tls_client.HttpClient](
+			p.IP,
+			p.Port,
+			proxstore.Protocol(strings.ToLower(string(p.Type))),
+		)
+	}
+	if p.Edges.ProxyProvider != nil {
+		existingProvider, ok := providers[p.Edges.ProxyProvider.ID]
+		if !ok {
+			existingProvider = &proxstore.Provider{
+				Name:        proxstore.ProviderName(p.Edges.ProxyProvider.Name),
+				ServiceType: p.Edges.ProxyProvider.ServiceType,
+				Username:    p.Edges.ProxyProvider.Username,
+				Password:    p.Edges.ProxyProvider.Password,
+			}
+			providers[p.Edges.ProxyProvider.ID] = existingProvider
+		}
+		prox = prox.SetProvider(existingProvider)
+	}
+	if p.Rotating {
+		prox.Rotating = true
+	}
+	if p.Country != "" {
+		prox.Country = strings.ToUpper(p.Country)
+	}
+	return prox
+}
+
 // prepareForDevRun sets up dev environment
 func prepareForDevRun(ctx context.Context) (err error) {
 	err = c.ORM.User.Create().
@@ -248,6 +248,7 @@ func prepareForDevRun(ctx context.Context) (err error) {
 				SetIP(p.Host).
 				SetPort(p.Port).
 				SetRotating(true).
+				SetCountry(p.Country).
 				SetUsername(p.Username).
 				SetPassword(p.Password)
 			if providerId > 0 {
@@ -68,6 +68,8 @@ type (
 		Pricing       Pricing
 		CaptchaSolver CaptchaSolver
 		ShapeSolver   ShapeSolver
+		VE            VEConfig
+		Tasks         TasksConfig
 		Tests         Tests
 	}
 
@@ -150,6 +152,148 @@ type (
 		ApiKey string
 	}
 
+	VEConfig struct {
+		Target         VETarget
+		CookieJar      VECookieJar
+		CircuitBreaker VECircuitBreaker
+		ResponseCache  VEResponseCache
+		GeoIP          VEGeoIP
+		ExitHistory    VEExitHistory
+		Pool           VEPool
+	}
+
+	VETarget struct {
+		// BaseURL is the scheme and host of the target, e.g., https://ve.cbi.ir
+		BaseURL string
+		// Headers are set on top of the default Chrome headers of the requests to the target
+		Headers map[string]string
+		// HealthCheckPath is the page the proxies are checked against
+		HealthCheckPath string
+		// Markers are the strings of which at least one is expected on the health check page
+		Markers []string
+	}
+
+	VECookieJar struct {
+		// Store is where the cookie jars of the sessions are persisted, either "redis" or "file"
+		Store string
+		// Dir is the directory of the jar files when Store is "file"
+		Dir string
+		// TTL is how long a jar is kept after its last use
+		TTL time.Duration
+		// CleanupInterval is the interval of saving and evicting the idle jars
+		CleanupInterval time.Duration
+	}
+
+	VECircuitBreaker struct {
+		// FailureThreshold is the number of consecutive failures of a host that opens its circuit
+		FailureThreshold int
+		// Cooldown is how long the circuit stays open before probing the host again
+		Cooldown time.Duration
+		// HalfOpenRequests is the number of probe requests let through after the cooldown
+		HalfOpenRequests int
+		// Shared shares the open circuits between the processes through Redis
+		Shared bool
+	}
+
+	VEResponseCache struct {
+		// Enabled enables caching the responses of the idempotent lookups, e.g., the exit ip
+		Enabled bool
+		// DefaultTTL is the freshness of the responses without Cache-Control or Expires
+		DefaultTTL time.Duration
+		// MaxBodySize is the maximum size of a cached body in bytes
+		MaxBodySize int
+	}
+
+	VEGeoIP struct {
+		// Databases are the paths of the MaxMind-format .mmdb files enriching the exits with country and ASN
+		Databases []string
+	}
+
+	VEExitHistory struct {
+		// Size is the number of the exit ips kept per proxy to detect the failed rotations, 0 disables the history
+		Size int
+		// ReportInterval is how often the gateways with a poor exit ip diversity are logged, 0 disables the report
+		ReportInterval time.Duration
+		// MinDiversity is the minimum unique exit ips per observation of a healthy gateway
+		MinDiversity float64
+		// MinObservations is the number of the exits in the history before a gateway is judged
+		MinObservations int
+	}
+
+	VEPool struct {
+		// MaxSize is the maximum number of sessions, idle or in use
+		MaxSize int
+		// MaxIdleTime is how long a session may stay idle before it's discarded, 0 means no limit
+		MaxIdleTime time.Duration
+		// MaxUses is the number of times a session is handed out before it's rebuilt, 0 means no limit
+		MaxUses int
+		// MinProxyScore is the minimum health score of the proxies of the new sessions
+		MinProxyScore float64
+	}
+
+	// TasksConfig stores the configuration of the tasks runner
+	TasksConfig struct {
+		// Concurrency is the number of the tasks processed at once, 0 means the number of CPUs
+		Concurrency int
+		// Queues are the priorities of the queues processed by the runner, by their name
+		Queues map[string]int
+		// StrictPriority processes the lower priority queues only once the higher priority ones are empty
+		StrictPriority bool
+		// ShutdownTimeout is how long the running tasks are waited for on shutdown
+		ShutdownTimeout time.Duration
+		// LogLevel is the level of the logs of asynq, one of debug, info, warn, error and fatal
+		LogLevel string
+		Retry    TasksRetry
+		// Limits are the named distributed concurrency limits of the task handlers
+		Limits map[string]TasksLimit
+		// Timezone is the default timezone of the intervals of the periodic tasks, e.g., "Asia/Tehran"
+		Timezone string
+		// Periodic are the periodic tasks declared at startup, by their name
+		Periodic map[string]TasksPeriodic
+		// SchedulerLockTTL is the ttl of the lock held by the instance leading the scheduling of the periodic tasks,
+		// another instance takes over within it once the leader is gone
+		SchedulerLockTTL time.Duration
+	}
+
+	TasksPeriodic struct {
+		// Type is the registered type of the task
+		Type string
+		// Cron is the interval of the task, either in cron form ("*/5 * * * *") or "@every 30s"
+		Cron string
+		// Timezone of the interval, defaults to the timezone of the tasks config
+		Timezone string
+		// Queue defaults to the queue of the task type
+		Queue string
+		// Payload is the JSON payload of the task, optional
+		Payload string
+	}
+
+	TasksLimit struct {
+		// Scope is what the tokens are counted per, one of "global", "type", "user" and "host"
+		Scope string
+		// Types are the task types the limit applies to, empty applies it to every type
+		Types []string
+		// Field is the gjson path of the user id, or of the url or host, in the payload of the task for
+		// the user and the host scopes, the user scope defaults to the owner of the task and the host one to "url"
+		Field string
+		// Max is the number of the tasks run at once per scope
+		Max int
+		// RetryIn is the delay of retrying a task that couldn't acquire a token
+		RetryIn time.Duration
+	}
+
+	TasksRetry struct {
+		// Policy of the delays between the retries, either "exponential", "linear" or "constant"
+		Policy string
+		// Delay is the delay of the constant policy and the step of the linear one
+		Delay time.Duration
+		// MaxDelay caps the delays, 0 means no cap
+		MaxDelay time.Duration
+		// MaxRateLimited is how many times a task failing on a rate limited or unavailable host, or on a proxy,
+		// is retried without counting as a failure, per instance
+		MaxRateLimited int
+	}
+
 	Tests struct {
 		Proxy TestsProxy
 	}
@@ -180,6 +324,37 @@ func GetConfig() (Config, error) {
 
 	// Defaults
 	v.SetDefault("app.name", "COUPLOAN")
+	v.SetDefault("ve.target.baseURL", "https://ve.cbi.ir")
+	v.SetDefault("ve.target.healthCheckPath", "/DefaultVE.aspx")
+	v.SetDefault("ve.target.markers", []string{`window["bobcmn"]`, "ازدواج"})
+	v.SetDefault("ve.cookieJar.store", "redis")
+	v.SetDefault("ve.cookieJar.dir", "cookiejars")
+	v.SetDefault("ve.cookieJar.ttl", "24h")
+	v.SetDefault("ve.cookieJar.cleanupInterval", "5m")
+	v.SetDefault("ve.circuitBreaker.failureThreshold", 5)
+	v.SetDefault("ve.circuitBreaker.cooldown", "30s")
+	v.SetDefault("ve.circuitBreaker.halfOpenRequests", 1)
+	v.SetDefault("ve.circuitBreaker.shared", true)
+	v.SetDefault("ve.responseCache.enabled", true)
+	v.SetDefault("ve.responseCache.defaultTTL", "0s")
+	v.SetDefault("ve.responseCache.maxBodySize", 1<<20)
+	v.SetDefault("ve.exitHistory.size", 32)
+	v.SetDefault("ve.exitHistory.reportInterval", "10m")
+	v.SetDefault("ve.exitHistory.minDiversity", 0.5)
+	v.SetDefault("ve.exitHistory.minObservations", 10)
+	v.SetDefault("ve.pool.maxSize", 10)
+	v.SetDefault("ve.pool.maxIdleTime", "5m")
+	v.SetDefault("ve.pool.maxUses", 50)
+	v.SetDefault("ve.pool.minProxyScore", 0.5)
+	v.SetDefault("tasks.concurrency", 1)
+	v.SetDefault("tasks.queues", map[string]int{"post": 3})
+	v.SetDefault("tasks.shutdownTimeout", "2m")
+	v.SetDefault("tasks.logLevel", "info")
+	v.SetDefault("tasks.retry.policy", "exponential")
+	v.SetDefault("tasks.retry.delay", "30s")
+	v.SetDefault("tasks.retry.maxRateLimited", 10)
+	v.SetDefault("tasks.timezone", "UTC")
+	v.SetDefault("tasks.schedulerLockTTL", "30s")
 
 	v.SetConfigName("config")
 	v.SetConfigType("yaml")
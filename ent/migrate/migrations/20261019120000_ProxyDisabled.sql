@@ -0,0 +1,2 @@
+-- Modify "proxies" table
+ALTER TABLE "proxies" ADD COLUMN "disabled" boolean NOT NULL DEFAULT false;
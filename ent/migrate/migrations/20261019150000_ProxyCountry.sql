@@ -0,0 +1,2 @@
+-- Modify "proxies" table
+ALTER TABLE "proxies" ADD COLUMN "country" character varying NOT NULL DEFAULT '';
@@ -17,6 +17,8 @@ var (
 		{Name: "username", Type: field.TypeString},
 		{Name: "password", Type: field.TypeString},
 		{Name: "rotating", Type: field.TypeBool, Default: false},
+		{Name: "disabled", Type: field.TypeBool, Default: false},
+		{Name: "country", Type: field.TypeString, Default: ""},
 		{Name: "proxy_proxy_provider", Type: field.TypeInt, Nullable: true},
 	}
 	// ProxiesTable holds the schema information for the "proxies" table.
@@ -27,7 +29,7 @@ var (
 		ForeignKeys: []*schema.ForeignKey{
 			{
 				Symbol:     "proxies_proxy_providers_proxyProvider",
-				Columns:    []*schema.Column{ProxiesColumns[7]},
+				Columns:    []*schema.Column{ProxiesColumns[9]},
 				RefColumns: []*schema.Column{ProxyProvidersColumns[0]},
 				OnDelete:   schema.SetNull,
 			},
@@ -45,6 +45,8 @@ type ProxyMutation struct {
 	username             *string
 	password             *string
 	rotating             *bool
+	disabled             *bool
+	country              *string
 	clearedFields        map[string]struct{}
 	proxyProvider        *int
 	clearedproxyProvider bool
@@ -387,6 +389,78 @@ func (m *ProxyMutation) ResetRotating() {
 	m.rotating = nil
 }
 
+// SetDisabled sets the "disabled" field.
+func (m *ProxyMutation) SetDisabled(b bool) {
+	m.disabled = &b
+}
+
+// Disabled returns the value of the "disabled" field in the mutation.
+func (m *ProxyMutation) Disabled() (r bool, exists bool) {
+	v := m.disabled
+	if v == nil {
+		return
+	}
+	return *v, true
+}
+
+// OldDisabled returns the old "disabled" field's value of the Proxy entity.
+// If the Proxy object wasn't provided to the builder, the object is fetched from the database.
+// An error is returned if the mutation operation is not UpdateOne, or the database query fails.
+func (m *ProxyMutation) OldDisabled(ctx context.Context) (v bool, err error) {
+	if !m.op.Is(OpUpdateOne) {
+		return v, errors.New("OldDisabled is only allowed on UpdateOne operations")
+	}
+	if m.id == nil || m.oldValue == nil {
+		return v, errors.New("OldDisabled requires an ID field in the mutation")
+	}
+	oldValue, err := m.oldValue(ctx)
+	if err != nil {
+		return v, fmt.Errorf("querying old value for OldDisabled: %w", err)
+	}
+	return oldValue.Disabled, nil
+}
+
+// ResetDisabled resets all changes to the "disabled" field.
+func (m *ProxyMutation) ResetDisabled() {
+	m.disabled = nil
+}
+
+// SetCountry sets the "country" field.
+func (m *ProxyMutation) SetCountry(s string) {
+	m.country = &s
+}
+
+// Country returns the value of the "country" field in the mutation.
+func (m *ProxyMutation) Country() (r string, exists bool) {
+	v := m.country
+	if v == nil {
+		return
+	}
+	return *v, true
+}
+
+// OldCountry returns the old "country" field's value of the Proxy entity.
+// If the Proxy object wasn't provided to the builder, the object is fetched from the database.
+// An error is returned if the mutation operation is not UpdateOne, or the database query fails.
+func (m *ProxyMutation) OldCountry(ctx context.Context) (v string, err error) {
+	if !m.op.Is(OpUpdateOne) {
+		return v, errors.New("OldCountry is only allowed on UpdateOne operations")
+	}
+	if m.id == nil || m.oldValue == nil {
+		return v, errors.New("OldCountry requires an ID field in the mutation")
+	}
+	oldValue, err := m.oldValue(ctx)
+	if err != nil {
+		return v, fmt.Errorf("querying old value for OldCountry: %w", err)
+	}
+	return oldValue.Country, nil
+}
+
+// ResetCountry resets all changes to the "country" field.
+func (m *ProxyMutation) ResetCountry() {
+	m.country = nil
+}
+
 // SetProxyProviderID sets the "proxyProvider" edge to the ProxyProvider entity by id.
 func (m *ProxyMutation) SetProxyProviderID(id int) {
 	m.proxyProvider = &id
@@ -460,7 +534,7 @@ func (m *ProxyMutation) Type() string {
 // order to get all numeric fields that were incremented/decremented, call
 // AddedFields().
 func (m *ProxyMutation) Fields() []string {
-	fields := make([]string, 0, 6)
+	fields := make([]string, 0, 8)
 	if m._type != nil {
 		fields = append(fields, proxy.FieldType)
 	}
@@ -479,6 +553,12 @@ func (m *ProxyMutation) Fields() []string {
 	if m.rotating != nil {
 		fields = append(fields, proxy.FieldRotating)
 	}
+	if m.disabled != nil {
+		fields = append(fields, proxy.FieldDisabled)
+	}
+	if m.country != nil {
+		fields = append(fields, proxy.FieldCountry)
+	}
 	return fields
 }
 
@@ -499,6 +579,10 @@ func (m *ProxyMutation) Field(name string) (ent.Value, bool) {
 		return m.Password()
 	case proxy.FieldRotating:
 		return m.Rotating()
+	case proxy.FieldDisabled:
+		return m.Disabled()
+	case proxy.FieldCountry:
+		return m.Country()
 	}
 	return nil, false
 }
@@ -520,6 +604,10 @@ func (m *ProxyMutation) OldField(ctx context.Context, name string) (ent.Value, e
 		return m.OldPassword(ctx)
 	case proxy.FieldRotating:
 		return m.OldRotating(ctx)
+	case proxy.FieldDisabled:
+		return m.OldDisabled(ctx)
+	case proxy.FieldCountry:
+		return m.OldCountry(ctx)
 	}
 	return nil, fmt.Errorf("unknown Proxy field %s", name)
 }
@@ -571,6 +659,20 @@ func (m *ProxyMutation) SetField(name string, value ent.Value) error {
 		}
 		m.SetRotating(v)
 		return nil
+	case proxy.FieldDisabled:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("unexpected type %T for field %s", value, name)
+		}
+		m.SetDisabled(v)
+		return nil
+	case proxy.FieldCountry:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("unexpected type %T for field %s", value, name)
+		}
+		m.SetCountry(v)
+		return nil
 	}
 	return fmt.Errorf("unknown Proxy field %s", name)
 }
@@ -653,6 +755,12 @@ func (m *ProxyMutation) ResetField(name string) error {
 	case proxy.FieldRotating:
 		m.ResetRotating()
 		return nil
+	case proxy.FieldDisabled:
+		m.ResetDisabled()
+		return nil
+	case proxy.FieldCountry:
+		m.ResetCountry()
+		return nil
 	}
 	return fmt.Errorf("unknown Proxy field %s", name)
 }
@@ -29,6 +29,10 @@ type Proxy struct {
 	Password *string `json:"password,omitempty"`
 	// Rotating holds the value of the "rotating" field.
 	Rotating bool `json:"rotating,omitempty"`
+	// Disabled proxies failed the check and are not loaded
+	Disabled bool `json:"disabled,omitempty"`
+	// Country is the ISO 3166-1 alpha-2 code the proxy claims to exit from, empty if it claims none
+	Country string `json:"country,omitempty"`
 	// Edges holds the relations/edges for other nodes in the graph.
 	// The values are being populated by the ProxyQuery when eager-loading is set.
 	Edges                ProxyEdges `json:"edges"`
@@ -61,11 +65,11 @@ func (*Proxy) scanValues(columns []string) ([]any, error) {
 	values := make([]any, len(columns))
 	for i := range columns {
 		switch columns[i] {
-		case proxy.FieldRotating:
+		case proxy.FieldRotating, proxy.FieldDisabled:
 			values[i] = new(sql.NullBool)
 		case proxy.FieldID, proxy.FieldPort:
 			values[i] = new(sql.NullInt64)
-		case proxy.FieldType, proxy.FieldIP, proxy.FieldUsername, proxy.FieldPassword:
+		case proxy.FieldType, proxy.FieldIP, proxy.FieldUsername, proxy.FieldPassword, proxy.FieldCountry:
 			values[i] = new(sql.NullString)
 		case proxy.ForeignKeys[0]: // proxy_proxy_provider
 			values[i] = new(sql.NullInt64)
@@ -128,6 +132,18 @@ func (pr *Proxy) assignValues(columns []string, values []any) error {
 			} else if value.Valid {
 				pr.Rotating = value.Bool
 			}
+		case proxy.FieldDisabled:
+			if value, ok := values[i].(*sql.NullBool); !ok {
+				return fmt.Errorf("unexpected type %T for field disabled", values[i])
+			} else if value.Valid {
+				pr.Disabled = value.Bool
+			}
+		case proxy.FieldCountry:
+			if value, ok := values[i].(*sql.NullString); !ok {
+				return fmt.Errorf("unexpected type %T for field country", values[i])
+			} else if value.Valid {
+				pr.Country = value.String
+			}
 		case proxy.ForeignKeys[0]:
 			if value, ok := values[i].(*sql.NullInt64); !ok {
 				return fmt.Errorf("unexpected type %T for edge-field proxy_proxy_provider", value)
@@ -197,6 +213,12 @@ func (pr *Proxy) String() string {
 	builder.WriteString(", ")
 	builder.WriteString("rotating=")
 	builder.WriteString(fmt.Sprintf("%v", pr.Rotating))
+	builder.WriteString(", ")
+	builder.WriteString("disabled=")
+	builder.WriteString(fmt.Sprintf("%v", pr.Disabled))
+	builder.WriteString(", ")
+	builder.WriteString("country=")
+	builder.WriteString(pr.Country)
 	builder.WriteByte(')')
 	return builder.String()
 }
@@ -26,6 +26,10 @@ const (
 	FieldPassword = "password"
 	// FieldRotating holds the string denoting the rotating field in the database.
 	FieldRotating = "rotating"
+	// FieldDisabled holds the string denoting the disabled field in the database.
+	FieldDisabled = "disabled"
+	// FieldCountry holds the string denoting the country field in the database.
+	FieldCountry = "country"
 	// EdgeProxyProvider holds the string denoting the proxyprovider edge name in mutations.
 	EdgeProxyProvider = "proxyProvider"
 	// Table holds the table name of the proxy in the database.
@@ -48,6 +52,8 @@ var Columns = []string{
 	FieldUsername,
 	FieldPassword,
 	FieldRotating,
+	FieldDisabled,
+	FieldCountry,
 }
 
 // ForeignKeys holds the SQL foreign-keys that are owned by the "proxies"
@@ -74,6 +80,10 @@ func ValidColumn(column string) bool {
 var (
 	// DefaultRotating holds the default value on creation for the "rotating" field.
 	DefaultRotating bool
+	// DefaultDisabled holds the default value on creation for the "disabled" field.
+	DefaultDisabled bool
+	// DefaultCountry holds the default value on creation for the "country" field.
+	DefaultCountry string
 )
 
 // Type defines the type for the "type" enum field.
@@ -140,6 +150,16 @@ func ByRotating(opts ...sql.OrderTermOption) OrderOption {
 	return sql.OrderByField(FieldRotating, opts...).ToFunc()
 }
 
+// ByDisabled orders the results by the disabled field.
+func ByDisabled(opts ...sql.OrderTermOption) OrderOption {
+	return sql.OrderByField(FieldDisabled, opts...).ToFunc()
+}
+
+// ByCountry orders the results by the country field.
+func ByCountry(opts ...sql.OrderTermOption) OrderOption {
+	return sql.OrderByField(FieldCountry, opts...).ToFunc()
+}
+
 // ByProxyProviderField orders the results by proxyProvider field.
 func ByProxyProviderField(field string, opts ...sql.OrderTermOption) OrderOption {
 	return func(s *sql.Selector) {
@@ -66,6 +66,34 @@ func (pc *ProxyCreate) SetNillableRotating(b *bool) *ProxyCreate {
 	return pc
 }
 
+// SetDisabled sets the "disabled" field.
+func (pc *ProxyCreate) SetDisabled(b bool) *ProxyCreate {
+	pc.mutation.SetDisabled(b)
+	return pc
+}
+
+// SetNillableDisabled sets the "disabled" field if the given value is not nil.
+func (pc *ProxyCreate) SetNillableDisabled(b *bool) *ProxyCreate {
+	if b != nil {
+		pc.SetDisabled(*b)
+	}
+	return pc
+}
+
+// SetCountry sets the "country" field.
+func (pc *ProxyCreate) SetCountry(s string) *ProxyCreate {
+	pc.mutation.SetCountry(s)
+	return pc
+}
+
+// SetNillableCountry sets the "country" field if the given value is not nil.
+func (pc *ProxyCreate) SetNillableCountry(s *string) *ProxyCreate {
+	if s != nil {
+		pc.SetCountry(*s)
+	}
+	return pc
+}
+
 // SetProxyProviderID sets the "proxyProvider" edge to the ProxyProvider entity by ID.
 func (pc *ProxyCreate) SetProxyProviderID(id int) *ProxyCreate {
 	pc.mutation.SetProxyProviderID(id)
@@ -124,6 +152,14 @@ func (pc *ProxyCreate) defaults() {
 		v := proxy.DefaultRotating
 		pc.mutation.SetRotating(v)
 	}
+	if _, ok := pc.mutation.Disabled(); !ok {
+		v := proxy.DefaultDisabled
+		pc.mutation.SetDisabled(v)
+	}
+	if _, ok := pc.mutation.Country(); !ok {
+		v := proxy.DefaultCountry
+		pc.mutation.SetCountry(v)
+	}
 }
 
 // check runs all checks and user-defined validators on the builder.
@@ -151,6 +187,12 @@ func (pc *ProxyCreate) check() error {
 	if _, ok := pc.mutation.Rotating(); !ok {
 		return &ValidationError{Name: "rotating", err: errors.New(`ent: missing required field "Proxy.rotating"`)}
 	}
+	if _, ok := pc.mutation.Disabled(); !ok {
+		return &ValidationError{Name: "disabled", err: errors.New(`ent: missing required field "Proxy.disabled"`)}
+	}
+	if _, ok := pc.mutation.Country(); !ok {
+		return &ValidationError{Name: "country", err: errors.New(`ent: missing required field "Proxy.country"`)}
+	}
 	return nil
 }
 
@@ -202,6 +244,14 @@ func (pc *ProxyCreate) createSpec() (*Proxy, *sqlgraph.CreateSpec) {
 		_spec.SetField(proxy.FieldRotating, field.TypeBool, value)
 		_node.Rotating = value
 	}
+	if value, ok := pc.mutation.Disabled(); ok {
+		_spec.SetField(proxy.FieldDisabled, field.TypeBool, value)
+		_node.Disabled = value
+	}
+	if value, ok := pc.mutation.Country(); ok {
+		_spec.SetField(proxy.FieldCountry, field.TypeString, value)
+		_node.Country = value
+	}
 	if nodes := pc.mutation.ProxyProviderIDs(); len(nodes) > 0 {
 		edge := &sqlgraph.EdgeSpec{
 			Rel:     sqlgraph.M2O,
@@ -349,6 +399,30 @@ func (u *ProxyUpsert) UpdateRotating() *ProxyUpsert {
 	return u
 }
 
+// SetDisabled sets the "disabled" field.
+func (u *ProxyUpsert) SetDisabled(v bool) *ProxyUpsert {
+	u.Set(proxy.FieldDisabled, v)
+	return u
+}
+
+// UpdateDisabled sets the "disabled" field to the value that was provided on create.
+func (u *ProxyUpsert) UpdateDisabled() *ProxyUpsert {
+	u.SetExcluded(proxy.FieldDisabled)
+	return u
+}
+
+// SetCountry sets the "country" field.
+func (u *ProxyUpsert) SetCountry(v string) *ProxyUpsert {
+	u.Set(proxy.FieldCountry, v)
+	return u
+}
+
+// UpdateCountry sets the "country" field to the value that was provided on create.
+func (u *ProxyUpsert) UpdateCountry() *ProxyUpsert {
+	u.SetExcluded(proxy.FieldCountry)
+	return u
+}
+
 // UpdateNewValues updates the mutable fields using the new values that were set on create.
 // Using this option is equivalent to using:
 //
@@ -480,6 +554,34 @@ func (u *ProxyUpsertOne) UpdateRotating() *ProxyUpsertOne {
 	})
 }
 
+// SetDisabled sets the "disabled" field.
+func (u *ProxyUpsertOne) SetDisabled(v bool) *ProxyUpsertOne {
+	return u.Update(func(s *ProxyUpsert) {
+		s.SetDisabled(v)
+	})
+}
+
+// UpdateDisabled sets the "disabled" field to the value that was provided on create.
+func (u *ProxyUpsertOne) UpdateDisabled() *ProxyUpsertOne {
+	return u.Update(func(s *ProxyUpsert) {
+		s.UpdateDisabled()
+	})
+}
+
+// SetCountry sets the "country" field.
+func (u *ProxyUpsertOne) SetCountry(v string) *ProxyUpsertOne {
+	return u.Update(func(s *ProxyUpsert) {
+		s.SetCountry(v)
+	})
+}
+
+// UpdateCountry sets the "country" field to the value that was provided on create.
+func (u *ProxyUpsertOne) UpdateCountry() *ProxyUpsertOne {
+	return u.Update(func(s *ProxyUpsert) {
+		s.UpdateCountry()
+	})
+}
+
 // Exec executes the query.
 func (u *ProxyUpsertOne) Exec(ctx context.Context) error {
 	if len(u.create.conflict) == 0 {
@@ -775,6 +877,34 @@ func (u *ProxyUpsertBulk) UpdateRotating() *ProxyUpsertBulk {
 	})
 }
 
+// SetDisabled sets the "disabled" field.
+func (u *ProxyUpsertBulk) SetDisabled(v bool) *ProxyUpsertBulk {
+	return u.Update(func(s *ProxyUpsert) {
+		s.SetDisabled(v)
+	})
+}
+
+// UpdateDisabled sets the "disabled" field to the value that was provided on create.
+func (u *ProxyUpsertBulk) UpdateDisabled() *ProxyUpsertBulk {
+	return u.Update(func(s *ProxyUpsert) {
+		s.UpdateDisabled()
+	})
+}
+
+// SetCountry sets the "country" field.
+func (u *ProxyUpsertBulk) SetCountry(v string) *ProxyUpsertBulk {
+	return u.Update(func(s *ProxyUpsert) {
+		s.SetCountry(v)
+	})
+}
+
+// UpdateCountry sets the "country" field to the value that was provided on create.
+func (u *ProxyUpsertBulk) UpdateCountry() *ProxyUpsertBulk {
+	return u.Update(func(s *ProxyUpsert) {
+		s.UpdateCountry()
+	})
+}
+
 // Exec executes the query.
 func (u *ProxyUpsertBulk) Exec(ctx context.Context) error {
 	if u.create.err != nil {
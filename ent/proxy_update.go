@@ -119,6 +119,34 @@ func (pu *ProxyUpdate) SetNillableRotating(b *bool) *ProxyUpdate {
 	return pu
 }
 
+// SetDisabled sets the "disabled" field.
+func (pu *ProxyUpdate) SetDisabled(b bool) *ProxyUpdate {
+	pu.mutation.SetDisabled(b)
+	return pu
+}
+
+// SetNillableDisabled sets the "disabled" field if the given value is not nil.
+func (pu *ProxyUpdate) SetNillableDisabled(b *bool) *ProxyUpdate {
+	if b != nil {
+		pu.SetDisabled(*b)
+	}
+	return pu
+}
+
+// SetCountry sets the "country" field.
+func (pu *ProxyUpdate) SetCountry(s string) *ProxyUpdate {
+	pu.mutation.SetCountry(s)
+	return pu
+}
+
+// SetNillableCountry sets the "country" field if the given value is not nil.
+func (pu *ProxyUpdate) SetNillableCountry(s *string) *ProxyUpdate {
+	if s != nil {
+		pu.SetCountry(*s)
+	}
+	return pu
+}
+
 // SetProxyProviderID sets the "proxyProvider" edge to the ProxyProvider entity by ID.
 func (pu *ProxyUpdate) SetProxyProviderID(id int) *ProxyUpdate {
 	pu.mutation.SetProxyProviderID(id)
@@ -219,6 +247,12 @@ func (pu *ProxyUpdate) sqlSave(ctx context.Context) (n int, err error) {
 	if value, ok := pu.mutation.Rotating(); ok {
 		_spec.SetField(proxy.FieldRotating, field.TypeBool, value)
 	}
+	if value, ok := pu.mutation.Disabled(); ok {
+		_spec.SetField(proxy.FieldDisabled, field.TypeBool, value)
+	}
+	if value, ok := pu.mutation.Country(); ok {
+		_spec.SetField(proxy.FieldCountry, field.TypeString, value)
+	}
 	if pu.mutation.ProxyProviderCleared() {
 		edge := &sqlgraph.EdgeSpec{
 			Rel:     sqlgraph.M2O,
@@ -359,6 +393,34 @@ func (puo *ProxyUpdateOne) SetNillableRotating(b *bool) *ProxyUpdateOne {
 	return puo
 }
 
+// SetDisabled sets the "disabled" field.
+func (puo *ProxyUpdateOne) SetDisabled(b bool) *ProxyUpdateOne {
+	puo.mutation.SetDisabled(b)
+	return puo
+}
+
+// SetNillableDisabled sets the "disabled" field if the given value is not nil.
+func (puo *ProxyUpdateOne) SetNillableDisabled(b *bool) *ProxyUpdateOne {
+	if b != nil {
+		puo.SetDisabled(*b)
+	}
+	return puo
+}
+
+// SetCountry sets the "country" field.
+func (puo *ProxyUpdateOne) SetCountry(s string) *ProxyUpdateOne {
+	puo.mutation.SetCountry(s)
+	return puo
+}
+
+// SetNillableCountry sets the "country" field if the given value is not nil.
+func (puo *ProxyUpdateOne) SetNillableCountry(s *string) *ProxyUpdateOne {
+	if s != nil {
+		puo.SetCountry(*s)
+	}
+	return puo
+}
+
 // SetProxyProviderID sets the "proxyProvider" edge to the ProxyProvider entity by ID.
 func (puo *ProxyUpdateOne) SetProxyProviderID(id int) *ProxyUpdateOne {
 	puo.mutation.SetProxyProviderID(id)
@@ -489,6 +551,12 @@ func (puo *ProxyUpdateOne) sqlSave(ctx context.Context) (_node *Proxy, err error
 	if value, ok := puo.mutation.Rotating(); ok {
 		_spec.SetField(proxy.FieldRotating, field.TypeBool, value)
 	}
+	if value, ok := puo.mutation.Disabled(); ok {
+		_spec.SetField(proxy.FieldDisabled, field.TypeBool, value)
+	}
+	if value, ok := puo.mutation.Country(); ok {
+		_spec.SetField(proxy.FieldCountry, field.TypeString, value)
+	}
 	if puo.mutation.ProxyProviderCleared() {
 		edge := &sqlgraph.EdgeSpec{
 			Rel:     sqlgraph.M2O,
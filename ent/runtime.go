@@ -21,6 +21,14 @@ func init() {
 	proxyDescRotating := proxyFields[5].Descriptor()
 	// proxy.DefaultRotating holds the default value on creation for the rotating field.
 	proxy.DefaultRotating = proxyDescRotating.Default.(bool)
+	// proxyDescDisabled is the schema descriptor for disabled field.
+	proxyDescDisabled := proxyFields[6].Descriptor()
+	// proxy.DefaultDisabled holds the default value on creation for the disabled field.
+	proxy.DefaultDisabled = proxyDescDisabled.Default.(bool)
+	// proxyDescCountry is the schema descriptor for country field.
+	proxyDescCountry := proxyFields[7].Descriptor()
+	// proxy.DefaultCountry holds the default value on creation for the country field.
+	proxy.DefaultCountry = proxyDescCountry.Default.(string)
 	userFields := schema.User{}.Fields()
 	_ = userFields
 	// userDescName is the schema descriptor for name field.
@@ -21,6 +21,9 @@ func (Proxy) Fields() []ent.Field {
 		field.String("username").Nillable(),
 		field.String("password").Nillable(),
 		field.Bool("rotating").Default(false),
+		field.Bool("disabled").Default(false).Comment("Disabled proxies failed the check and are not loaded"),
+		field.String("country").Default("").
+			Comment("Country is the ISO 3166-1 alpha-2 code the proxy claims to exit from, empty if it claims none"),
 	}
 }
 
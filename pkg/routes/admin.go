@@ -0,0 +1,177 @@
+package routes
+
+import (
+	"github.com/Dissociable/Couploan/pkg/middleware"
+	"github.com/Dissociable/Couploan/pkg/page"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/Dissociable/Couploan/pkg/tasks"
+	"github.com/gofiber/fiber/v3"
+	"github.com/hibiken/asynq"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// adminRoutes registers the admin-only queue management, tasks runner health, task metrics, periodic tasks
+// and session pool api
+func adminRoutes(c *services.Container, g fiber.Router) {
+	g.Get(
+		"/admin/tasks/health", middleware.RequireAdminUser(), func(ctx fiber.Ctx) error {
+			if c.TasksRunner == nil {
+				return fiber.ErrServiceUnavailable
+			}
+			health := c.TasksRunner.Health()
+			if !health.Healthy {
+				ctx.Status(fiber.StatusServiceUnavailable)
+			}
+			return ctx.JSON(health)
+		},
+	)
+	g.Get(
+		"/admin/tasks/metrics", middleware.RequireAdminUser(), func(ctx fiber.Ctx) error {
+			if c.TasksRunner == nil {
+				return fiber.ErrServiceUnavailable
+			}
+			return ctx.JSON(c.TasksRunner.Metrics())
+		},
+	)
+	g.Get(
+		"/admin/sessions/pool", middleware.RequireAdminUser(), func(ctx fiber.Ctx) error {
+			if c.SessionPool == nil {
+				return fiber.ErrServiceUnavailable
+			}
+			return ctx.JSON(c.SessionPool.Stats())
+		},
+	)
+	g.Get(
+		"/admin/tasks/periodic", middleware.RequireAdminUser(), func(ctx fiber.Ctx) error {
+			admin, err := queueAdmin(c)
+			if err != nil {
+				return queueError(c, err)
+			}
+			periodic, err := admin.Periodic()
+			if err != nil {
+				return queueError(c, err)
+			}
+			return ctx.JSON(periodic)
+		},
+	)
+
+	q := g.Group("/admin/queues", middleware.RequireAdminUser())
+	q.Get(
+		"", func(ctx fiber.Ctx) error {
+			admin, err := queueAdmin(c)
+			if err != nil {
+				return queueError(c, err)
+			}
+			stats, err := admin.Stats()
+			if err != nil {
+				return queueError(c, err)
+			}
+			return ctx.JSON(stats)
+		},
+	)
+	q.Get(
+		"/:queue", func(ctx fiber.Ctx) error {
+			admin, err := queueAdmin(c)
+			if err != nil {
+				return queueError(c, err)
+			}
+			stats, err := admin.Queue(ctx.Params("queue"))
+			if err != nil {
+				return queueError(c, err)
+			}
+			return ctx.JSON(stats)
+		},
+	)
+	q.Get(
+		"/:queue/:state", func(ctx fiber.Ctx) error {
+			admin, err := queueAdmin(c)
+			if err != nil {
+				return queueError(c, err)
+			}
+			list, err := admin.List(
+				ctx.Params("queue"), ctx.Params("state"),
+				fiber.Query[int](ctx, "page", 1), fiber.Query[int](ctx, "size", page.DefaultItemsPerPage),
+			)
+			if err != nil {
+				return queueError(c, err)
+			}
+			return ctx.JSON(list)
+		},
+	)
+	q.Post(
+		"/:queue/pause", func(ctx fiber.Ctx) error {
+			admin, err := queueAdmin(c)
+			if err == nil {
+				err = admin.Pause(ctx.Params("queue"))
+			}
+			if err != nil {
+				return queueError(c, err)
+			}
+			return ctx.SendStatus(fiber.StatusNoContent)
+		},
+	)
+	q.Post(
+		"/:queue/unpause", func(ctx fiber.Ctx) error {
+			admin, err := queueAdmin(c)
+			if err == nil {
+				err = admin.Unpause(ctx.Params("queue"))
+			}
+			if err != nil {
+				return queueError(c, err)
+			}
+			return ctx.SendStatus(fiber.StatusNoContent)
+		},
+	)
+	q.Post(
+		"/:queue/tasks/:id/:action", func(ctx fiber.Ctx) error {
+			admin, err := queueAdmin(c)
+			if err == nil {
+				err = admin.Act(ctx.Params("queue"), ctx.Params("id"), tasks.TaskAction(ctx.Params("action")))
+			}
+			if err != nil {
+				return queueError(c, err)
+			}
+			return ctx.SendStatus(fiber.StatusNoContent)
+		},
+	)
+	q.Post(
+		"/:queue/:state/:action", func(ctx fiber.Ctx) error {
+			admin, err := queueAdmin(c)
+			if err != nil {
+				return queueError(c, err)
+			}
+			n, err := admin.ActAll(ctx.Params("queue"), ctx.Params("state"), tasks.TaskAction(ctx.Params("action")))
+			if err != nil {
+				return queueError(c, err)
+			}
+			return ctx.JSON(fiber.Map{"count": n})
+		},
+	)
+}
+
+// queueAdmin returns a queue admin on the inspector of the tasks runner of the container
+func queueAdmin(c *services.Container) (*tasks.QueueAdmin, error) {
+	if c.TasksRunner == nil {
+		return nil, tasks.ErrInspectorNotStarted
+	}
+	inspector, err := c.TasksRunner.Inspector()
+	if err != nil {
+		return nil, err
+	}
+	return tasks.NewQueueAdmin(inspector), nil
+}
+
+// queueError maps the error of a queue admin operation to its status
+func queueError(c *services.Container, err error) error {
+	switch {
+	case errors.Is(err, asynq.ErrQueueNotFound), errors.Is(err, asynq.ErrTaskNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, tasks.ErrUnknownTaskState), errors.Is(err, tasks.ErrUnsupportedAction):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, tasks.ErrInspectorNotStarted):
+		return fiber.ErrServiceUnavailable
+	}
+	c.Logger.Error("failed to manage queues", zap.Error(err))
+	return fiber.ErrInternalServerError
+}
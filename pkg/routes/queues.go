@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"github.com/Dissociable/Couploan/pkg/middleware"
+	"github.com/Dissociable/Couploan/pkg/page"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/Dissociable/Couploan/pkg/tasks"
+	"github.com/Dissociable/Couploan/templates"
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	routeNameQueues = string(templates.PageQueues)
+)
+
+type (
+	// Queues is the queue management page, its actions are sent to the admin queue api
+	Queues struct {
+		*services.TemplateRenderer
+		c *services.Container
+	}
+
+	queuesData struct {
+		Queues []*tasks.QueueStats
+		// Queue and State are the selected queue and state of the listed tasks
+		Queue  string
+		State  string
+		States []string
+		Tasks  []*tasks.QueueTask
+		Error  string
+	}
+)
+
+func init() {
+	Register(new(Queues))
+}
+
+func (h *Queues) Init(c *services.Container) error {
+	h.TemplateRenderer = c.TemplateRenderer
+	h.c = c
+	return nil
+}
+
+func (h *Queues) Routes(g fiber.Router) {
+	m := g.Group("/manage/queues", middleware.RequireAdminUser())
+	m.Get("", h.Page).Name(routeNameQueues)
+}
+
+func (h *Queues) Page(ctx fiber.Ctx) error {
+	p := page.New(ctx)
+	p.Layout = templates.LayoutMain
+	p.Name = templates.PageQueues
+	p.Title = "Queues"
+
+	data := queuesData{
+		Queue:  ctx.Query("queue"),
+		State:  ctx.Query("state", "pending"),
+		States: tasks.TaskStates,
+	}
+	p.Data = &data
+	admin, err := queueAdmin(h.c)
+	if err != nil {
+		data.Error = err.Error()
+		return h.RenderPage(ctx, p)
+	}
+	if data.Queues, err = admin.Stats(); err != nil {
+		data.Error = err.Error()
+		return h.RenderPage(ctx, p)
+	}
+	if data.Queue != "" {
+		data.Tasks, err = admin.List(data.Queue, data.State, p.Pager.Page, p.Pager.ItemsPerPage)
+		if err != nil {
+			data.Error = err.Error()
+		}
+	}
+	return h.RenderPage(ctx, p)
+}
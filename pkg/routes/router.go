@@ -129,6 +129,8 @@ func BuildRouter(c *services.Container) {
 	// Example routes
 	navRoutes(c, g)
 	userRoutes(c, gApiV1)
+	taskRoutes(c, gApiV1)
+	adminRoutes(c, gApiV1)
 }
 
 func navRoutes(c *services.Container, g fiber.Router) {
@@ -83,3 +83,47 @@ func TestApiCheckFraud(t *testing.T) {
 	// assert.Equal(t, resp.StatusCode, http.StatusOK)
 	// assert.Equal(t, beforeRequestBalance-Container.Config.Pricing.PricePerCheck, afterRequestBalance)
 }
+
+func TestApiTaskStatus(t *testing.T) {
+	var err error
+	TestUser, err = TestUser.Update().SetBalance(100).Save(context.Background())
+	require.NoError(t, err)
+	headers := http.Header{
+		"Authorization": {"Bearer " + *TestUser.Key},
+	}
+
+	// The tasks of the other users are reported as missing
+	resp, err := tests.NewContextTestWithHeaders(
+		Container.Web, "/api/v1/tasks/"+services.OwnedTaskID("someone", "1"), headers, func(ctx fiber.Ctx) {},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = tests.NewContextTestWithHeaders(
+		Container.Web, "/api/v1/tasks/"+services.OwnedTaskID(TestUser.ID.String(), "missing"), headers,
+		func(ctx fiber.Ctx) {},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestApiAdminQueuesRequireAdmin(t *testing.T) {
+	var err error
+	TestUser, err = TestUser.Update().SetBalance(100).Save(context.Background())
+	require.NoError(t, err)
+	headers := http.Header{
+		"Authorization": {"Bearer " + *TestUser.Key},
+	}
+	paths := []string{
+		"/api/v1/admin/queues",
+		"/api/v1/admin/tasks/health",
+		"/api/v1/admin/tasks/metrics",
+		"/api/v1/admin/tasks/periodic",
+		"/api/v1/admin/sessions/pool",
+	}
+	for _, path := range paths {
+		resp, err := tests.NewContextTestWithHeaders(Container.Web, path, headers, func(ctx fiber.Ctx) {})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, path)
+	}
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"github.com/Dissociable/Couploan/ent"
+	"github.com/Dissociable/Couploan/pkg/context"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/gofiber/fiber/v3"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// taskRoutes registers the task status api
+func taskRoutes(c *services.Container, g fiber.Router) {
+	g.Get(
+		"/tasks/:id", func(ctx fiber.Ctx) error {
+			u := ctx.Locals(context.AuthenticatedUserKey).(*ent.User)
+			id := ctx.Params("id")
+			// The tasks of the other users are reported as missing, not to leak their existence
+			if services.TaskOwner(id) != u.ID.String() {
+				return fiber.ErrNotFound
+			}
+			status, err := c.Tasks.Status(id)
+			if err != nil {
+				if errors.Is(err, services.ErrTaskNotFound) {
+					return fiber.ErrNotFound
+				}
+				c.Logger.Error("failed to get task status", zap.String("task_id", id), zap.Error(err))
+				return fiber.ErrServiceUnavailable
+			}
+			return ctx.JSON(status)
+		},
+	)
+}
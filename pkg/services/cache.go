@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/ve/httpcache"
 	"github.com/eko/gocache/lib/v4/cache"
 	redisstore "github.com/eko/gocache/store/redis/v4"
 )
@@ -55,8 +56,16 @@ type (
 		key    string
 		group  string
 	}
+
+	// httpCacheStore adapts the cache client to the store of the http response cache
+	httpCacheStore struct {
+		client *CacheClient
+	}
 )
 
+// httpCacheGroup is the cache group of the http responses
+const httpCacheGroup = "httpcache"
+
 // NewCacheClient creates a new cache client
 func NewCacheClient(cfg *config.Config) (*CacheClient, error) {
 	// Determine the database based on the environment
@@ -273,3 +282,27 @@ func (c *cacheExist) Execute(ctx context.Context) (bool, error) {
 
 	return true, nil
 }
+
+// HTTPCacheStore returns the cache as the store of the http response cache of the ve requests
+func (c *CacheClient) HTTPCacheStore() httpcache.Store {
+	return &httpCacheStore{client: c}
+}
+
+func (s *httpCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := s.client.Get().Group(httpCacheGroup).Key(key).Type(new([]byte)).Fetch(ctx)
+	if err != nil {
+		if errors.Is(err, &store.NotFound{}) {
+			return nil, httpcache.ErrCacheMiss
+		}
+		return nil, err
+	}
+	return *data.(*[]byte), nil
+}
+
+func (s *httpCacheStore) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	return s.client.Set().Group(httpCacheGroup).Key(key).Data(data).Expiration(ttl).Save(ctx)
+}
+
+func (s *httpCacheStore) Delete(ctx context.Context, key string) error {
+	return s.client.Flush().Group(httpCacheGroup).Key(key).Execute(ctx)
+}
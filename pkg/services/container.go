@@ -11,15 +11,19 @@ import (
 	"github.com/Dissociable/Couploan/logger"
 	"github.com/Dissociable/Couploan/pkg/funcmap"
 	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve"
+	"github.com/Dissociable/Couploan/ve/httpcache"
 	tls_client "github.com/bogdanfinn/tls-client"
 	"github.com/bogdanfinn/tls-client/profiles"
 	"github.com/goccy/go-json"
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/log"
 	"github.com/gofiber/fiber/v3/middleware/session"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"net/url"
 	"strings"
+	"time"
 	// Required by ent
 	"ariga.io/atlas-go-sdk/atlasexec"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -59,9 +63,33 @@ type Container struct {
 	// Tasks stores the Task client
 	Tasks *TaskClient
 
+	// TasksRunner stores the runner processing the tasks, nil until it's started by tasks.StartTasksRunner
+	TasksRunner TasksRunner
+
 	Logger *zap.Logger
 
 	ProxyStore *proxstore.ProxStore[tls_client.HttpClient]
+
+	// TargetProfile stores the profile of the target of the ve sessions
+	TargetProfile *ve.TargetProfile
+
+	// CookieJars stores the cookie jars of the ve sessions
+	CookieJars *ve.CookieJarSessions
+
+	// CircuitBreaker stores the circuit breaker shared by the ve sessions
+	CircuitBreaker *ve.CircuitBreaker
+
+	// ResponseCache stores the http response cache of the ve sessions, nil if it's disabled
+	ResponseCache *httpcache.Cache
+
+	// GeoIP stores the geoip databases enriching the exits of the proxies, nil if there are none
+	GeoIP *ve.GeoIP
+
+	// SessionPool stores the pool of the ve sessions
+	SessionPool *ve.Pool
+
+	// shutdownHooks are run by Shutdown before the services are disconnected, see OnShutdown
+	shutdownHooks []func(ctx context.Context) error
 }
 
 // NewContainer creates and initializes a new Container
@@ -78,11 +106,42 @@ func NewContainer() *Container {
 	c.initTemplateRenderer()
 	c.initTasks()
 	c.initProxyStore()
+	c.initDiversityReport()
+	c.initTargetProfile()
+	c.initCookieJars()
+	c.initCircuitBreaker()
+	c.initResponseCache()
+	c.initGeoIP()
+	c.initSessionPool()
 	return c
 }
 
+// OnShutdown registers fn to be run by Shutdown before the services are disconnected, the last registered first
+func (c *Container) OnShutdown(fn func(ctx context.Context) error) {
+	c.shutdownHooks = append(c.shutdownHooks, fn)
+}
+
 // Shutdown shuts the Container down and disconnects all connections
 func (c *Container) Shutdown() error {
+	for i := len(c.shutdownHooks) - 1; i >= 0; i-- {
+		if err := c.shutdownHooks[i](context.Background()); err != nil {
+			return err
+		}
+	}
+	c.shutdownHooks = nil
+	if c.CookieJars != nil {
+		if err := c.CookieJars.Close(context.Background()); err != nil {
+			return err
+		}
+	}
+	if c.SessionPool != nil {
+		c.SessionPool.Close()
+	}
+	if c.GeoIP != nil {
+		if err := c.GeoIP.Close(); err != nil {
+			return err
+		}
+	}
 	if c.Tasks != nil {
 		if err := c.Tasks.Close(); err != nil {
 			return err
@@ -346,7 +405,13 @@ func (c *Container) initLogger() {
 
 func (c *Container) initProxyStore() {
 	tls_client.DefaultTimeoutSeconds = 20
-	options := proxstore.Options{AllowDirect: false}
+	options := proxstore.Options{
+		AllowDirect:     false,
+		ExitHistorySize: c.Config.VE.ExitHistory.Size,
+		OnFailedRotation: func(proxyID string, exit proxstore.Exit) {
+			c.Logger.Warn("proxy kept its exit ip after release", zap.String("proxy", proxyID), zap.String("ip", exit.IP))
+		},
+	}
 	optionsCreateHttpClient := proxstore.OptionsCreateHttpClient[tls_client.HttpClient]{
 		Creator: func(proxy *proxstore.Proxy[tls_client.HttpClient]) (hc tls_client.HttpClient, err error) {
 			opts := []tls_client.HttpClientOption{
@@ -362,3 +427,149 @@ func (c *Container) initProxyStore() {
 	}
 	c.ProxyStore = proxstore.NewWithOptions[tls_client.HttpClient](&options, &optionsCreateHttpClient)
 }
+
+// initDiversityReport periodically logs the gateways that don't rotate their exit ip enough, e.g., a rotating proxy
+// that keeps handing out a few ips
+func (c *Container) initDiversityReport() {
+	cfg := c.Config.VE.ExitHistory
+	if cfg.Size == 0 || cfg.ReportInterval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(cfg.ReportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, proxy := range c.ProxyStore.PoorDiversity(cfg.MinDiversity, cfg.MinObservations) {
+					stats := proxy.RotationStats()
+					c.Logger.Warn(
+						"proxy has a poor exit ip diversity",
+						zap.String("proxy", proxy.ID()),
+						zap.Int("observations", stats.Observations),
+						zap.Int("uniqueIPs", stats.UniqueIPs),
+						zap.Float64("diversity", stats.Diversity),
+						zap.Int("failedRotations", stats.FailedRotations),
+					)
+				}
+			}
+		}
+	}()
+	c.OnShutdown(
+		func(context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	)
+}
+
+// initCookieJars initializes the persisted cookie jars of the ve sessions
+func (c *Container) initCookieJars() {
+	var store ve.CookieJarStore
+	switch c.Config.VE.CookieJar.Store {
+	case "file":
+		fileStore, err := ve.NewFileCookieJarStore(c.Config.VE.CookieJar.Dir)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create cookie jar store: %v", err))
+		}
+		store = fileStore
+	default:
+		store = ve.NewRedisCookieJarStore(c.Cache.Client)
+	}
+	cookieJars, err := ve.NewCookieJarSessions(
+		ve.CookieJarSessionsOptions{
+			Store:           store,
+			TTL:             c.Config.VE.CookieJar.TTL,
+			CleanupInterval: c.Config.VE.CookieJar.CleanupInterval,
+			Logger:          c.Logger.Named("CookieJars"),
+		},
+	)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create cookie jars: %v", err))
+	}
+	c.CookieJars = cookieJars
+}
+
+// initTargetProfile initializes the profile of the target of the ve sessions
+func (c *Container) initTargetProfile() {
+	c.TargetProfile = ve.NewTargetProfile(c.Config.VE.Target)
+}
+
+// initCircuitBreaker initializes the circuit breaker of the ve sessions
+func (c *Container) initCircuitBreaker() {
+	options := ve.CircuitBreakerOptions{
+		FailureThreshold: c.Config.VE.CircuitBreaker.FailureThreshold,
+		Cooldown:         c.Config.VE.CircuitBreaker.Cooldown,
+		HalfOpenRequests: c.Config.VE.CircuitBreaker.HalfOpenRequests,
+	}
+	if c.Config.VE.CircuitBreaker.Shared {
+		options.Store = ve.NewRedisCircuitBreakerStore(c.Cache.Client)
+	}
+	c.CircuitBreaker = ve.NewCircuitBreaker(options)
+}
+
+// initResponseCache initializes the http response cache of the ve sessions
+func (c *Container) initResponseCache() {
+	if !c.Config.VE.ResponseCache.Enabled {
+		return
+	}
+	responseCache, err := httpcache.New(
+		httpcache.Options{
+			Store:       c.Cache.HTTPCacheStore(),
+			DefaultTTL:  c.Config.VE.ResponseCache.DefaultTTL,
+			MaxBodySize: c.Config.VE.ResponseCache.MaxBodySize,
+		},
+	)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create response cache: %v", err))
+	}
+	c.ResponseCache = responseCache
+}
+
+// initGeoIP initializes the geoip databases
+func (c *Container) initGeoIP() {
+	if len(c.Config.VE.GeoIP.Databases) == 0 {
+		return
+	}
+	geoIP, err := ve.OpenGeoIP(c.Config.VE.GeoIP.Databases...)
+	if err != nil {
+		panic(fmt.Sprintf("failed to open geoip databases: %v", err))
+	}
+	c.GeoIP = geoIP
+}
+
+// initSessionPool initializes the pool of the ve sessions
+func (c *Container) initSessionPool() {
+	c.SessionPool = ve.NewPool(
+		c.Config, c.ProxyStore, ve.PoolOptions{
+			MaxSize:       c.Config.VE.Pool.MaxSize,
+			MaxIdleTime:   c.Config.VE.Pool.MaxIdleTime,
+			MaxUses:       c.Config.VE.Pool.MaxUses,
+			MinProxyScore: c.Config.VE.Pool.MinProxyScore,
+			New: func(proxy *proxstore.Proxy[tls_client.HttpClient]) *ve.VE {
+				v := ve.New(c.Config, c.ProxyStore, proxy).
+					SetTarget(c.TargetProfile).
+					SetCircuitBreaker(c.CircuitBreaker).
+					SetResponseCache(c.ResponseCache).
+					SetGeoIP(c.GeoIP)
+				// Every pooled session has its own cookie jar, even on a proxy shared with the others, e.g., a rotating
+				// gateway, the pool deletes it once the session is discarded
+				if err := v.SetSessionID(context.Background(), c.CookieJars, "pool:"+uuid.NewString()); err != nil {
+					c.Logger.Warn("failed to load cookie jar of session", zap.Error(err))
+				}
+				return v
+			},
+			// The index opens the session of the target, so the sessions are handed out ready to use
+			Warmup: func(ctx context.Context, v *ve.VE) error {
+				_, err := v.Index(ctx)
+				return err
+			},
+		},
+	)
+}
@@ -3,10 +3,23 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Dissociable/Couploan/config"
+	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	// ErrUnknownTaskType is returned by Task.Save when the type of the task isn't registered
+	ErrUnknownTaskType = errors.New("unknown task type")
+	// ErrTaskNotFound is returned by TaskClient.Status when there's no task with the id in any queue
+	ErrTaskNotFound = errors.New("task not found")
 )
 
 type (
@@ -15,8 +28,12 @@ type (
 		// client stores the asynq client
 		client *asynq.Client
 
-		// scheduler stores the asynq scheduler
-		scheduler *asynq.Scheduler
+		// periodic stores the periodic tasks, by their id, they're scheduled by the leading tasks scheduler
+		periodicMu sync.RWMutex
+		periodic   map[string]PeriodicTask
+
+		// inspector stores the asynq inspector, used to look the saved tasks up
+		inspector *asynq.Inspector
 	}
 
 	// Task handles Task creation operations
@@ -25,6 +42,7 @@ type (
 		typ        string
 		payload    interface{}
 		periodic   *string
+		timezone   *string
 		queue      *string
 		maxRetries *int
 		timeout    *time.Duration
@@ -33,9 +51,132 @@ type (
 		wait       *time.Duration
 		retain     *time.Duration
 		uniqueId   *string
+		unique     *time.Duration
+		owner      *string
+	}
+
+	// TaskHandle identifies a saved task
+	TaskHandle struct {
+		// ID is the id of the task, or the id of the periodic task, see PeriodicTaskID
+		ID    string
+		Type  string
+		Queue string
+		// Periodic is whether the task was declared to the scheduler rather than enqueued
+		Periodic bool
+		// Duplicate is whether the task wasn't enqueued since it's a duplicate of another one, see Task.Unique
+		// and Task.UniqueID, the ID is only set when the id of the task was set
+		Duplicate bool
 	}
+
+	// PeriodicTask is a task enqueued periodically by the scheduler
+	PeriodicTask struct {
+		// ID identifies the periodic task by its type and spec, see PeriodicTaskID
+		ID string
+		// Spec is the cron spec of the task, prefixed with its timezone when it's set, e.g., "CRON_TZ=UTC 0 * * * *"
+		Spec string
+		Task *asynq.Task
+	}
+
+	// TaskStatus is the state of a saved task
+	TaskStatus struct {
+		ID    string `json:"id"`
+		Type  string `json:"type"`
+		Queue string `json:"queue"`
+		// State is one of active, pending, aggregating, scheduled, retry, archived and completed
+		State string `json:"state"`
+		// Attempts is the number of the times the task has been retried
+		Attempts      int        `json:"attempts"`
+		MaxRetry      int        `json:"max_retry"`
+		LastError     string     `json:"last_error,omitempty"`
+		LastFailedAt  *time.Time `json:"last_failed_at,omitempty"`
+		NextProcessAt *time.Time `json:"next_process_at,omitempty"`
+		CompletedAt   *time.Time `json:"completed_at,omitempty"`
+		// Result is the result written by the handler, as is when it's JSON, as a JSON string otherwise
+		Result json.RawMessage `json:"result,omitempty"`
+	}
+
+	// TasksRunner processes the saved tasks, see tasks.TasksRunner
+	TasksRunner interface {
+		// Health returns the health of the runner
+		Health() TasksRunnerHealth
+		// Inspector returns the inspector of the queues, it fails while the runner isn't connected
+		Inspector() (*asynq.Inspector, error)
+		// Metrics returns the metrics of the processed tasks, by their type
+		Metrics() map[string]TaskTypeStats
+	}
+
+	// TaskTypeStats is a snapshot of the metrics of the processed tasks of a type
+	TaskTypeStats struct {
+		// Processed is the number of the processed tasks, in any outcome
+		Processed   uint64 `json:"processed"`
+		Succeeded   uint64 `json:"succeeded"`
+		Failed      uint64 `json:"failed"`
+		RateLimited uint64 `json:"rate_limited"`
+		// Panicked tasks are also counted as Failed
+		Panicked uint64 `json:"panicked"`
+		// Duration is the total time spent processing the tasks, MaxDuration the longest of them
+		Duration    time.Duration `json:"duration_ns"`
+		MaxDuration time.Duration `json:"max_duration_ns"`
+	}
+
+	// TasksRunnerHealth is the health of a TasksRunner
+	TasksRunnerHealth struct {
+		// Healthy is whether the runner is connected to redis and processing the tasks
+		Healthy bool `json:"healthy"`
+		// State is one of starting, running, reconnecting and stopped
+		State     string    `json:"state"`
+		LastError string    `json:"last_error,omitempty"`
+		LastPing  time.Time `json:"last_ping,omitempty"`
+		// Reconnects is the number of the times the runner has reconnected
+		Reconnects int `json:"reconnects"`
+		// Since is when the runner entered its state
+		Since time.Time `json:"since"`
+	}
+
+	// TaskTypeOptions are the defaults of the tasks of a type, the options set on a Task take precedence
+	TaskTypeOptions struct {
+		// Queue defaults to the default queue of asynq
+		Queue string
+		// MaxRetries defaults to the default of asynq, 25
+		MaxRetries *int
+		// Timeout defaults to the default of asynq, 30 minutes
+		Timeout time.Duration
+		// Retention is how long the completed tasks and their results are kept, 0 deletes them on completion
+		Retention time.Duration
+	}
+)
+
+var (
+	taskTypesMu sync.RWMutex
+	taskTypes   = map[string]TaskTypeOptions{}
 )
 
+// RegisterTaskType declares the task type so its tasks can be saved, it's called by tasks.Register
+func RegisterTaskType(typ string, options TaskTypeOptions) {
+	taskTypesMu.Lock()
+	defer taskTypesMu.Unlock()
+	taskTypes[typ] = options
+}
+
+// LookupTaskType returns the options of the task type, ok is false when it's not registered
+func LookupTaskType(typ string) (options TaskTypeOptions, ok bool) {
+	taskTypesMu.RLock()
+	defer taskTypesMu.RUnlock()
+	options, ok = taskTypes[typ]
+	return
+}
+
+// TaskTypes returns the registered task types and their options
+func TaskTypes() map[string]TaskTypeOptions {
+	taskTypesMu.RLock()
+	defer taskTypesMu.RUnlock()
+	types := make(map[string]TaskTypeOptions, len(taskTypes))
+	for typ, options := range taskTypes {
+		types[typ] = options
+	}
+	return types
+}
+
 // NewTaskClient creates a new task client
 func NewTaskClient(cfg *config.Config) *TaskClient {
 	// Determine the database based on the environment
@@ -50,26 +191,107 @@ func NewTaskClient(cfg *config.Config) *TaskClient {
 		DB:       db,
 	}
 
-	loc, err := time.LoadLocation("Asia/Tehran")
-	if err != nil {
-		panic(err)
-	}
-
 	return &TaskClient{
 		client:    asynq.NewClient(conn),
-		scheduler: asynq.NewScheduler(conn, &asynq.SchedulerOpts{Location: loc}),
+		inspector: asynq.NewInspector(conn),
+		periodic:  map[string]PeriodicTask{},
 	}
 }
 
 // Close closes the connection to the task service
 func (t *TaskClient) Close() error {
+	if err := t.inspector.Close(); err != nil {
+		return err
+	}
 	return t.client.Close()
 }
 
-// StartScheduler starts the scheduler service which adds scheduled tasks to the queue
-// This must be running to queue tasks set for periodic execution
-func (t *TaskClient) StartScheduler() error {
-	return t.scheduler.Run()
+// Status returns the status of the task with the id, looking it up in every queue
+func (t *TaskClient) Status(id string) (*TaskStatus, error) {
+	queues, err := t.inspector.Queues()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list queues")
+	}
+	for _, queue := range queues {
+		info, err := t.inspector.GetTaskInfo(queue, id)
+		if err != nil {
+			if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to get task %s", id)
+		}
+		return NewTaskStatus(info), nil
+	}
+	return nil, errors.Wrapf(ErrTaskNotFound, "%s", id)
+}
+
+// AvgDuration returns the average time spent processing a task
+func (s TaskTypeStats) AvgDuration() time.Duration {
+	if s.Processed == 0 {
+		return 0
+	}
+	return s.Duration / time.Duration(s.Processed)
+}
+
+// NewTaskStatus returns the status of the task
+func NewTaskStatus(info *asynq.TaskInfo) *TaskStatus {
+	status := &TaskStatus{
+		ID:        info.ID,
+		Type:      info.Type,
+		Queue:     info.Queue,
+		State:     info.State.String(),
+		Attempts:  info.Retried,
+		MaxRetry:  info.MaxRetry,
+		LastError: info.LastErr,
+	}
+	timeP := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	status.LastFailedAt = timeP(info.LastFailedAt)
+	status.NextProcessAt = timeP(info.NextProcessAt)
+	status.CompletedAt = timeP(info.CompletedAt)
+	if len(info.Result) > 0 {
+		if json.Valid(info.Result) {
+			status.Result = info.Result
+		} else {
+			status.Result, _ = json.Marshal(string(info.Result))
+		}
+	}
+	return status
+}
+
+// OwnedTaskID returns the id of the task of the owner, see Task.Owner
+func OwnedTaskID(owner string, id string) string {
+	return owner + ":" + id
+}
+
+// TaskOwner returns the owner of the task with the id, or an empty string when it has none
+func TaskOwner(id string) string {
+	owner, _, ok := strings.Cut(id, ":")
+	if !ok {
+		return ""
+	}
+	return owner
+}
+
+// PeriodicTaskID returns the id of the periodic task of the type with the spec
+func PeriodicTaskID(typ string, spec string) string {
+	return typ + "@" + spec
+}
+
+// PeriodicTasks returns the periodic tasks, sorted by their id
+func (t *TaskClient) PeriodicTasks() []PeriodicTask {
+	t.periodicMu.RLock()
+	defer t.periodicMu.RUnlock()
+	tasks := make([]PeriodicTask, 0, len(t.periodic))
+	for _, task := range t.periodic {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks
 }
 
 // New starts a task creation operation
@@ -88,11 +310,21 @@ func (t *Task) Payload(payload interface{}) *Task {
 
 // Periodic sets the task to execute periodically according to a given interval
 // The interval can be either in cron form ("*/5 * * * *") or "@every 30s"
+//
+// Saving it declares the task to the scheduler, which starts enqueueing it on the instance leading the scheduling,
+// see tasks.StartScheduler. Saving another one of the same type and interval replaces it.
 func (t *Task) Periodic(interval string) *Task {
 	t.periodic = &interval
 	return t
 }
 
+// Timezone sets the timezone of the interval of a periodic task, e.g., "Asia/Tehran", it defaults to the timezone
+// of the tasks config
+func (t *Task) Timezone(name string) *Task {
+	t.timezone = &name
+	return t
+}
+
 // Queue specifies the name of the queue to add the task to
 // The default queue will be used if this is not set
 func (t *Task) Queue(queue string) *Task {
@@ -124,6 +356,21 @@ func (t *Task) UniqueID(id string) *Task {
 	return t
 }
 
+// Unique sets the task to be unique for the ttl, i.e., enqueueing another one of the same type, payload
+// and queue while it's not yet processed, or within the ttl, is reported as a duplicate by Save
+func (t *Task) Unique(ttl time.Duration) *Task {
+	t.unique = &ttl
+	return t
+}
+
+// Owner sets the owner of the task, e.g., the id of the user, which is encoded into its id
+//
+// The id of the task is generated unless it's set via UniqueID. It has no effect on the periodic tasks.
+func (t *Task) Owner(owner string) *Task {
+	t.owner = &owner
+	return t
+}
+
 // Wait instructs the task to wait a given duration before it is executed
 func (t *Task) Wait(duration time.Duration) *Task {
 	t.wait = &duration
@@ -142,28 +389,42 @@ func (t *Task) MaxRetries(retries int) *Task {
 	return t
 }
 
-// Save saves the task so it can be executed
-func (t *Task) Save() error {
+// Save saves the task so it can be executed, the returned handle identifies it
+//
+// ErrUnknownTaskType is returned when the type of the task isn't registered, see RegisterTaskType.
+func (t *Task) Save() (*TaskHandle, error) {
 	var err error
 
+	typeOptions, ok := LookupTaskType(t.typ)
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownTaskType, "%q", t.typ)
+	}
+
 	// Build the payload
 	var payload []byte
 	if t.payload != nil {
 		if payload, err = json.Marshal(t.payload); err != nil {
-			return err
+			return nil, errors.Wrap(err, "failed to marshal task payload")
 		}
 	}
 
-	// Build the task options
-	opts := make([]asynq.Option, 0)
+	// Build the task options, falling back to the defaults of the type
+	queue := "default"
 	if t.queue != nil {
-		opts = append(opts, asynq.Queue(*t.queue))
+		queue = *t.queue
+	} else if typeOptions.Queue != "" {
+		queue = typeOptions.Queue
 	}
+	opts := []asynq.Option{asynq.Queue(queue)}
 	if t.maxRetries != nil {
 		opts = append(opts, asynq.MaxRetry(*t.maxRetries))
+	} else if typeOptions.MaxRetries != nil {
+		opts = append(opts, asynq.MaxRetry(*typeOptions.MaxRetries))
 	}
 	if t.timeout != nil {
 		opts = append(opts, asynq.Timeout(*t.timeout))
+	} else if typeOptions.Timeout > 0 {
+		opts = append(opts, asynq.Timeout(typeOptions.Timeout))
 	}
 	if t.deadline != nil {
 		opts = append(opts, asynq.Deadline(*t.deadline))
@@ -173,12 +434,26 @@ func (t *Task) Save() error {
 	}
 	if t.retain != nil {
 		opts = append(opts, asynq.Retention(*t.retain))
+	} else if typeOptions.Retention > 0 {
+		opts = append(opts, asynq.Retention(typeOptions.Retention))
 	}
 	if t.at != nil {
 		opts = append(opts, asynq.ProcessAt(*t.at))
 	}
-	if t.uniqueId != nil {
-		opts = append(opts, asynq.TaskID(*t.uniqueId))
+	id := t.uniqueId
+	if t.owner != nil && t.periodic == nil {
+		ownedID := uuid.NewString()
+		if id != nil {
+			ownedID = *id
+		}
+		ownedID = OwnedTaskID(*t.owner, ownedID)
+		id = &ownedID
+	}
+	if id != nil {
+		opts = append(opts, asynq.TaskID(*id))
+	}
+	if t.unique != nil {
+		opts = append(opts, asynq.Unique(*t.unique))
 	}
 
 	// Build the task
@@ -186,9 +461,32 @@ func (t *Task) Save() error {
 
 	// Schedule, if needed
 	if t.periodic != nil {
-		_, err = t.client.scheduler.Register(*t.periodic, task)
-	} else {
-		_, err = t.client.client.Enqueue(task)
+		spec := *t.periodic
+		if t.timezone != nil && *t.timezone != "" {
+			if _, err = time.LoadLocation(*t.timezone); err != nil {
+				return nil, errors.Wrapf(err, "invalid timezone of periodic task %s", t.typ)
+			}
+			spec = "CRON_TZ=" + *t.timezone + " " + spec
+		}
+		if _, err = cron.ParseStandard(spec); err != nil {
+			return nil, errors.Wrapf(err, "invalid interval of periodic task %s", t.typ)
+		}
+		id := PeriodicTaskID(t.typ, spec)
+		t.client.periodicMu.Lock()
+		t.client.periodic[id] = PeriodicTask{ID: id, Spec: spec, Task: task}
+		t.client.periodicMu.Unlock()
+		return &TaskHandle{ID: id, Type: t.typ, Queue: queue, Periodic: true}, nil
+	}
+	info, err := t.client.client.Enqueue(task)
+	if errors.Is(err, asynq.ErrDuplicateTask) || errors.Is(err, asynq.ErrTaskIDConflict) {
+		handle := &TaskHandle{Type: t.typ, Queue: queue, Duplicate: true}
+		if id != nil {
+			handle.ID = *id
+		}
+		return handle, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to enqueue task %s", t.typ)
 	}
-	return err
+	return &TaskHandle{ID: info.ID, Type: info.Type, Queue: info.Queue}, nil
 }
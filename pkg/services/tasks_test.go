@@ -4,10 +4,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hibiken/asynq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTaskClient_New(t *testing.T) {
+	RegisterTaskType("task1", TaskTypeOptions{Queue: "queue"})
 	now := time.Now()
 	tk := c.Tasks.
 		New("task1").
@@ -31,5 +34,87 @@ func TestTaskClient_New(t *testing.T) {
 	assert.Equal(t, now, *tk.at)
 	assert.Equal(t, 6*time.Second, *tk.wait)
 	assert.Equal(t, 7*time.Second, *tk.retain)
-	assert.NoError(t, tk.Save())
+	handle, err := tk.Save()
+	require.NoError(t, err)
+	assert.True(t, handle.Periodic)
+	assert.Equal(t, "queue", handle.Queue)
+	assert.Equal(t, PeriodicTaskID("task1", "@every 5s"), handle.ID)
+
+	_, err = c.Tasks.New("unknown").Save()
+	assert.ErrorIs(t, err, ErrUnknownTaskType)
+}
+
+func TestTaskClient_Periodic(t *testing.T) {
+	RegisterTaskType("task4", TaskTypeOptions{})
+	handle, err := c.Tasks.New("task4").Periodic("0 * * * *").Timezone("Asia/Tehran").Save()
+	require.NoError(t, err)
+	assert.Equal(t, PeriodicTaskID("task4", "CRON_TZ=Asia/Tehran 0 * * * *"), handle.ID)
+	// Saving it again replaces it
+	_, err = c.Tasks.New("task4").Payload("payload").Periodic("0 * * * *").Timezone("Asia/Tehran").Save()
+	require.NoError(t, err)
+
+	var found []PeriodicTask
+	for _, task := range c.Tasks.PeriodicTasks() {
+		if task.Task.Type() == "task4" {
+			found = append(found, task)
+		}
+	}
+	require.Len(t, found, 1)
+	assert.Equal(t, "CRON_TZ=Asia/Tehran 0 * * * *", found[0].Spec)
+	assert.Equal(t, `"payload"`, string(found[0].Task.Payload()))
+
+	_, err = c.Tasks.New("task4").Periodic("0 * * * *").Timezone("Mars/Olympus").Save()
+	assert.Error(t, err)
+	_, err = c.Tasks.New("task4").Periodic("every hour").Save()
+	assert.Error(t, err)
+}
+
+func TestTaskClient_Status(t *testing.T) {
+	RegisterTaskType("task2", TaskTypeOptions{Queue: "queue", Retention: time.Minute})
+	owner := usr.ID.String()
+	handle, err := c.Tasks.New("task2").Payload("payload").Owner(owner).Wait(time.Hour).Save()
+	require.NoError(t, err)
+	assert.Equal(t, owner, TaskOwner(handle.ID))
+	assert.Equal(t, "queue", handle.Queue)
+
+	status, err := c.Tasks.Status(handle.ID)
+	require.NoError(t, err)
+	assert.Equal(t, handle.ID, status.ID)
+	assert.Equal(t, "scheduled", status.State)
+	assert.NotNil(t, status.NextProcessAt)
+
+	_, err = c.Tasks.Status(OwnedTaskID(owner, "missing"))
+	assert.ErrorIs(t, err, ErrTaskNotFound)
+}
+
+func TestTaskClient_Unique(t *testing.T) {
+	RegisterTaskType("task3", TaskTypeOptions{Queue: "queue"})
+	// The payload is unique per run, so a rerun within the unique ttl isn't a duplicate of the previous run
+	payload := "unique:" + usr.ID.String()
+	save := func() *TaskHandle {
+		handle, err := c.Tasks.New("task3").Payload(payload).Unique(time.Minute).Wait(time.Hour).Save()
+		require.NoError(t, err)
+		return handle
+	}
+	assert.False(t, save().Duplicate)
+	assert.True(t, save().Duplicate)
+
+	id := OwnedTaskID(usr.ID.String(), "unique")
+	handle, err := c.Tasks.New("task3").Owner(usr.ID.String()).UniqueID("unique").Wait(time.Hour).Save()
+	require.NoError(t, err)
+	assert.Equal(t, id, handle.ID)
+	handle, err = c.Tasks.New("task3").Owner(usr.ID.String()).UniqueID("unique").Wait(time.Hour).Save()
+	require.NoError(t, err)
+	assert.True(t, handle.Duplicate)
+	assert.Equal(t, id, handle.ID)
+}
+
+func TestNewTaskStatus(t *testing.T) {
+	status := NewTaskStatus(&asynq.TaskInfo{ID: "1", State: asynq.TaskStateCompleted, Result: []byte("done")})
+	assert.Equal(t, "completed", status.State)
+	assert.JSONEq(t, `"done"`, string(status.Result))
+	assert.Nil(t, status.CompletedAt)
+
+	status = NewTaskStatus(&asynq.TaskInfo{ID: "1", State: asynq.TaskStateCompleted, Result: []byte(`{"ok":true}`)})
+	assert.JSONEq(t, `{"ok":true}`, string(status.Result))
 }
@@ -0,0 +1,258 @@
+package tasks
+
+import (
+	"encoding/json"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/hibiken/asynq"
+	"github.com/pkg/errors"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrInspectorNotStarted is returned by TasksRunner.Inspector while the runner isn't connected
+	ErrInspectorNotStarted = errors.New("task inspector is not started")
+	// ErrUnknownTaskState is returned for a state tasks can't be listed or acted upon in
+	ErrUnknownTaskState = errors.New("unknown task state")
+	// ErrUnsupportedAction is returned for an action that doesn't apply to the tasks of a state
+	ErrUnsupportedAction = errors.New("unsupported action")
+)
+
+// TaskAction is an action of QueueAdmin on the tasks
+type TaskAction string
+
+const (
+	// ActionRetry runs the task now
+	ActionRetry TaskAction = "retry"
+	// ActionArchive archives the task, so it's not processed unless retried
+	ActionArchive TaskAction = "archive"
+	// ActionDelete deletes the task
+	ActionDelete TaskAction = "delete"
+)
+
+// TaskStates are the states the tasks can be listed in, the aggregating tasks are left out since they're grouped
+var TaskStates = []string{"pending", "active", "scheduled", "retry", "archived", "completed"}
+
+// QueueStats is a snapshot of the metrics of a queue
+type QueueStats struct {
+	Queue  string `json:"queue"`
+	Paused bool   `json:"paused"`
+	// Size is the number of the tasks in the queue, in any state but completed
+	Size        int `json:"size"`
+	Pending     int `json:"pending"`
+	Active      int `json:"active"`
+	Scheduled   int `json:"scheduled"`
+	Retry       int `json:"retry"`
+	Archived    int `json:"archived"`
+	Completed   int `json:"completed"`
+	Aggregating int `json:"aggregating"`
+	// Processed and Failed are counted today, ProcessedTotal and FailedTotal since the queue was created
+	Processed      int `json:"processed"`
+	Failed         int `json:"failed"`
+	ProcessedTotal int `json:"processed_total"`
+	FailedTotal    int `json:"failed_total"`
+	// LatencyMS is the age of the oldest pending task
+	LatencyMS   int64     `json:"latency_ms"`
+	MemoryUsage int64     `json:"memory_usage"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// QueueTask is a task listed by QueueAdmin
+type QueueTask struct {
+	*services.TaskStatus
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// PeriodicEntry is a periodic task scheduled by the leading scheduler
+type PeriodicEntry struct {
+	// ID is the id of the entry of the scheduler, it changes whenever another instance takes the scheduling over
+	ID      string          `json:"id"`
+	Spec    string          `json:"spec"`
+	Type    string          `json:"type"`
+	Queue   string          `json:"queue"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Next is when the task is enqueued next, Prev when it was last enqueued, nil if it wasn't yet
+	Next time.Time  `json:"next"`
+	Prev *time.Time `json:"prev,omitempty"`
+}
+
+// QueueAdmin inspects and manages the queues of the tasks
+type QueueAdmin struct {
+	inspector *asynq.Inspector
+}
+
+// NewQueueAdmin creates a queue admin on the inspector
+func NewQueueAdmin(inspector *asynq.Inspector) *QueueAdmin {
+	return &QueueAdmin{inspector: inspector}
+}
+
+// Stats returns the stats of every queue
+func (a *QueueAdmin) Stats() ([]*QueueStats, error) {
+	queues, err := a.inspector.Queues()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list queues")
+	}
+	stats := make([]*QueueStats, 0, len(queues))
+	for _, queue := range queues {
+		s, err := a.Queue(queue)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// Queue returns the stats of the queue
+func (a *QueueAdmin) Queue(queue string) (*QueueStats, error) {
+	info, err := a.inspector.GetQueueInfo(queue)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get info of queue %s", queue)
+	}
+	return &QueueStats{
+		Queue:          info.Queue,
+		Paused:         info.Paused,
+		Size:           info.Size,
+		Pending:        info.Pending,
+		Active:         info.Active,
+		Scheduled:      info.Scheduled,
+		Retry:          info.Retry,
+		Archived:       info.Archived,
+		Completed:      info.Completed,
+		Aggregating:    info.Aggregating,
+		Processed:      info.Processed,
+		Failed:         info.Failed,
+		ProcessedTotal: info.ProcessedTotal,
+		FailedTotal:    info.FailedTotal,
+		LatencyMS:      info.Latency.Milliseconds(),
+		MemoryUsage:    info.MemoryUsage,
+		Timestamp:      info.Timestamp,
+	}, nil
+}
+
+// List returns a page of the tasks of the queue in the state, page starts from 1
+func (a *QueueAdmin) List(queue string, state string, page int, size int) ([]*QueueTask, error) {
+	var list func(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	switch state {
+	case "pending":
+		list = a.inspector.ListPendingTasks
+	case "active":
+		list = a.inspector.ListActiveTasks
+	case "scheduled":
+		list = a.inspector.ListScheduledTasks
+	case "retry":
+		list = a.inspector.ListRetryTasks
+	case "archived":
+		list = a.inspector.ListArchivedTasks
+	case "completed":
+		list = a.inspector.ListCompletedTasks
+	default:
+		return nil, errors.Wrapf(ErrUnknownTaskState, "%q", state)
+	}
+	infos, err := list(queue, asynq.Page(page), asynq.PageSize(size))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list %s tasks of queue %s", state, queue)
+	}
+	tasks := make([]*QueueTask, len(infos))
+	for i, info := range infos {
+		tasks[i] = &QueueTask{TaskStatus: services.NewTaskStatus(info)}
+		if len(info.Payload) > 0 && json.Valid(info.Payload) {
+			tasks[i].Payload = info.Payload
+		}
+	}
+	return tasks, nil
+}
+
+// Act applies the action to the task of the queue
+func (a *QueueAdmin) Act(queue string, id string, action TaskAction) error {
+	var err error
+	switch action {
+	case ActionRetry:
+		err = a.inspector.RunTask(queue, id)
+	case ActionArchive:
+		err = a.inspector.ArchiveTask(queue, id)
+	case ActionDelete:
+		err = a.inspector.DeleteTask(queue, id)
+	default:
+		return errors.Wrapf(ErrUnsupportedAction, "%q", action)
+	}
+	return errors.Wrapf(err, "failed to %s task %s of queue %s", action, id, queue)
+}
+
+// ActAll applies the action to every task of the queue in the state and returns the number of the tasks acted upon
+func (a *QueueAdmin) ActAll(queue string, state string, action TaskAction) (int, error) {
+	bulk := map[TaskAction]map[string]func(queue string) (int, error){
+		ActionRetry: {
+			"scheduled": a.inspector.RunAllScheduledTasks,
+			"retry":     a.inspector.RunAllRetryTasks,
+			"archived":  a.inspector.RunAllArchivedTasks,
+		},
+		ActionArchive: {
+			"pending":   a.inspector.ArchiveAllPendingTasks,
+			"scheduled": a.inspector.ArchiveAllScheduledTasks,
+			"retry":     a.inspector.ArchiveAllRetryTasks,
+		},
+		ActionDelete: {
+			"pending":   a.inspector.DeleteAllPendingTasks,
+			"scheduled": a.inspector.DeleteAllScheduledTasks,
+			"retry":     a.inspector.DeleteAllRetryTasks,
+			"archived":  a.inspector.DeleteAllArchivedTasks,
+			"completed": a.inspector.DeleteAllCompletedTasks,
+		},
+	}
+	states, ok := bulk[action]
+	if !ok {
+		return 0, errors.Wrapf(ErrUnsupportedAction, "%q", action)
+	}
+	fn, ok := states[state]
+	if !ok {
+		return 0, errors.Wrapf(ErrUnsupportedAction, "%q of the %s tasks", action, state)
+	}
+	n, err := fn(queue)
+	if err != nil {
+		return n, errors.Wrapf(err, "failed to %s the %s tasks of queue %s", action, state, queue)
+	}
+	return n, nil
+}
+
+// Pause pauses the processing of the tasks of the queue
+func (a *QueueAdmin) Pause(queue string) error {
+	return errors.Wrapf(a.inspector.PauseQueue(queue), "failed to pause queue %s", queue)
+}
+
+// Unpause resumes the processing of the tasks of the queue
+func (a *QueueAdmin) Unpause(queue string) error {
+	return errors.Wrapf(a.inspector.UnpauseQueue(queue), "failed to unpause queue %s", queue)
+}
+
+// Periodic returns the periodic tasks of the leading scheduler, sorted by when they're enqueued next
+func (a *QueueAdmin) Periodic() ([]*PeriodicEntry, error) {
+	entries, err := a.inspector.SchedulerEntries()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list scheduler entries")
+	}
+	periodic := make([]*PeriodicEntry, len(entries))
+	for i, entry := range entries {
+		periodic[i] = &PeriodicEntry{
+			ID:    entry.ID,
+			Spec:  entry.Spec,
+			Type:  entry.Task.Type(),
+			Queue: "default",
+			Next:  entry.Next,
+		}
+		for _, opt := range entry.Opts {
+			if opt.Type() == asynq.QueueOpt {
+				periodic[i].Queue = opt.Value().(string)
+			}
+		}
+		if payload := entry.Task.Payload(); len(payload) > 0 && json.Valid(payload) {
+			periodic[i].Payload = payload
+		}
+		if !entry.Prev.IsZero() {
+			prev := entry.Prev
+			periodic[i].Prev = &prev
+		}
+	}
+	sort.Slice(periodic, func(i, j int) bool { return periodic[i].Next.Before(periodic[j].Next) })
+	return periodic, nil
+}
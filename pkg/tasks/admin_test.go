@@ -0,0 +1,21 @@
+package tasks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueAdminRejects(t *testing.T) {
+	admin := NewQueueAdmin(nil)
+
+	_, err := admin.List("default", "aggregating", 1, 10)
+	assert.ErrorIs(t, err, ErrUnknownTaskState)
+
+	assert.ErrorIs(t, admin.Act("default", "1", "run"), ErrUnsupportedAction)
+
+	_, err = admin.ActAll("default", "active", ActionDelete)
+	assert.ErrorIs(t, err, ErrUnsupportedAction, "the active tasks can't be deleted")
+	_, err = admin.ActAll("default", "pending", ActionRetry)
+	assert.ErrorIs(t, err, ErrUnsupportedAction, "the pending tasks are already run")
+}
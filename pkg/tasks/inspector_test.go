@@ -0,0 +1,41 @@
+package tasks
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTaskQueueForTaskExistence(t *testing.T) {
+	var all []*asynq.TaskInfo
+	for i := 0; i < 2*listPageSize+1; i++ {
+		all = append(all, &asynq.TaskInfo{ID: fmt.Sprint(i)})
+	}
+	// The pages are listed in order
+	calls := 0
+	list := func(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error) {
+		start := calls * listPageSize
+		calls++
+		return all[start:min(start+listPageSize, len(all))], nil
+	}
+
+	exists, err := CheckTaskQueueForTaskExistence(list, "default", fmt.Sprint(2*listPageSize))
+	require.NoError(t, err)
+	assert.True(t, exists, "the last page is looked at")
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	exists, err = CheckTaskQueueForTaskExistence(list, "default", "missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = CheckTaskQueueForTaskExistence(
+		func(string, ...asynq.ListOption) ([]*asynq.TaskInfo, error) { return nil, asynq.ErrQueueNotFound },
+		"missing", "1",
+	)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"context"
+	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/hibiken/asynq"
+	"github.com/hibiken/asynq/x/rate"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// LimitScopeGlobal counts the tokens of a limit across every task it applies to
+	LimitScopeGlobal = "global"
+	// LimitScopeType counts the tokens of a limit per task type
+	LimitScopeType = "type"
+	// LimitScopeUser counts the tokens of a limit per user
+	LimitScopeUser = "user"
+	// LimitScopeHost counts the tokens of a limit per target host
+	LimitScopeHost = "host"
+
+	// defaultLimitRetryIn is the delay of retrying a task that couldn't acquire a token of a limit without RetryIn
+	defaultLimitRetryIn = 10 * time.Second
+)
+
+// Limits are the named distributed concurrency limits of the task handlers, backed by asynq semaphores
+type Limits struct {
+	pool   *SharedRedisPool
+	logger *zap.Logger
+	limits map[string]config.TasksLimit
+	// names are the names of the limits, sorted, so the tokens are always acquired in the same order
+	names []string
+}
+
+// NewLimits creates the limits on the shared redis pool
+func NewLimits(pool *SharedRedisPool, logger *zap.Logger, limits map[string]config.TasksLimit) (*Limits, error) {
+	l := &Limits{
+		pool:   pool,
+		logger: logger,
+		limits: limits,
+	}
+	for name, limit := range limits {
+		if limit.Max < 1 {
+			return nil, errors.Errorf("limit %s must have a max of at least 1", name)
+		}
+		switch limit.Scope {
+		case LimitScopeGlobal, LimitScopeType, LimitScopeUser, LimitScopeHost:
+		default:
+			return nil, errors.Errorf("limit %s has an unknown scope %q", name, limit.Scope)
+		}
+		l.names = append(l.names, name)
+	}
+	sort.Strings(l.names)
+	return l, nil
+}
+
+// key returns the scope key of the limit for the task with the id, ok is false when the limit doesn't apply to it
+func key(name string, limit config.TasksLimit, id string, task *asynq.Task) (scope string, ok bool) {
+	if len(limit.Types) > 0 && !slices.Contains(limit.Types, task.Type()) {
+		return "", false
+	}
+	scope = "limit:" + name
+	switch limit.Scope {
+	case LimitScopeGlobal:
+		return scope, true
+	case LimitScopeType:
+		return scope + ":" + task.Type(), true
+	case LimitScopeUser:
+		user := services.TaskOwner(id)
+		if limit.Field != "" {
+			user = gjson.GetBytes(task.Payload(), limit.Field).String()
+		}
+		if user == "" {
+			return "", false
+		}
+		return scope + ":" + user, true
+	case LimitScopeHost:
+		field := limit.Field
+		if field == "" {
+			field = "url"
+		}
+		host := gjson.GetBytes(task.Payload(), field).String()
+		if strings.Contains(host, "://") {
+			u, err := url.Parse(host)
+			if err != nil {
+				return "", false
+			}
+			host = u.Hostname()
+		}
+		if host == "" {
+			return "", false
+		}
+		return scope + ":" + strings.ToLower(host), true
+	}
+	return "", false
+}
+
+// Middleware acquires a token of every limit applying to the task before running it
+//
+// A task that can't acquire a token fails with a RateLimitError, so its retry isn't counted as a failure.
+// The tokens are released once the task is done, even when it panics or times out, a token which couldn't be
+// released expires with the deadline of the task.
+func (l *Limits) Middleware() asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(
+			func(ctx context.Context, task *asynq.Task) error {
+				id, _ := asynq.GetTaskID(ctx)
+				var acquired []*rate.Semaphore
+				defer func() {
+					// The context may be done already, e.g., on timeout, the task id is all Release needs from it
+					releaseCtx := context.WithoutCancel(ctx)
+					for _, s := range acquired {
+						if err := s.Release(releaseCtx); err != nil {
+							l.logger.Warn("failed to release limit token", zap.String("task_id", id), zap.Error(err))
+						}
+					}
+				}()
+				for _, name := range l.names {
+					limit := l.limits[name]
+					scope, ok := key(name, limit, id, task)
+					if !ok {
+						continue
+					}
+					// A semaphore is only a handle on the client of the pool, so it isn't kept, as the user and host
+					// scopes are unbounded
+					s := rate.NewSemaphore(l.pool, scope, limit.Max)
+					ok, err := s.Acquire(ctx)
+					if err != nil {
+						return errors.Wrapf(err, "failed to acquire token of limit %s", scope)
+					}
+					if !ok {
+						retryIn := limit.RetryIn
+						if retryIn <= 0 {
+							retryIn = defaultLimitRetryIn
+						}
+						return &RateLimitError{RetryIn: retryIn, Err: errors.Errorf("limit %s is reached", scope)}
+					}
+					acquired = append(acquired, s)
+				}
+				return next.ProcessTask(ctx, task)
+			},
+		)
+	}
+}
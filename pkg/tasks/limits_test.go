@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLimitKey(t *testing.T) {
+	task := asynq.NewTask("ve:register", []byte(`{"user_id":"u2","target":{"url":"https://VE.cbi.ir/DefaultVE.aspx"}}`))
+	id := services.OwnedTaskID("u1", "1")
+
+	tests := []struct {
+		name  string
+		limit config.TasksLimit
+		scope string
+	}{
+		{"global", config.TasksLimit{Scope: LimitScopeGlobal}, "limit:global"},
+		{"type", config.TasksLimit{Scope: LimitScopeType, Types: []string{"ve:register"}}, "limit:type:ve:register"},
+		{"owner", config.TasksLimit{Scope: LimitScopeUser}, "limit:owner:u1"},
+		{"user", config.TasksLimit{Scope: LimitScopeUser, Field: "user_id"}, "limit:user:u2"},
+		{"host", config.TasksLimit{Scope: LimitScopeHost, Field: "target.url"}, "limit:host:ve.cbi.ir"},
+		{"other", config.TasksLimit{Scope: LimitScopeGlobal, Types: []string{"other"}}, ""},
+		{"nohost", config.TasksLimit{Scope: LimitScopeHost}, ""},
+	}
+	for _, tt := range tests {
+		scope, ok := key(tt.name, tt.limit, id, task)
+		assert.Equal(t, tt.scope != "", ok, tt.name)
+		assert.Equal(t, tt.scope, scope, tt.name)
+	}
+}
+
+func TestNewLimits(t *testing.T) {
+	_, err := NewLimits(nil, zap.NewNop(), map[string]config.TasksLimit{"a": {Scope: LimitScopeGlobal}})
+	assert.Error(t, err, "max must be set")
+	_, err = NewLimits(nil, zap.NewNop(), map[string]config.TasksLimit{"a": {Scope: "queue", Max: 1}})
+	assert.Error(t, err, "the scope must be known")
+
+	l, err := NewLimits(
+		nil, zap.NewNop(), map[string]config.TasksLimit{
+			"b": {Scope: LimitScopeGlobal, Types: []string{"b"}, Max: 1},
+			"a": {Scope: LimitScopeGlobal, Types: []string{"a"}, Max: 1},
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, l.names)
+
+	// No limit applies to the task, so no token is acquired
+	ran := false
+	h := l.Middleware()(
+		asynq.HandlerFunc(
+			func(ctx context.Context, task *asynq.Task) error {
+				ran = true
+				return nil
+			},
+		),
+	)
+	require.NoError(t, h.ProcessTask(context.Background(), asynq.NewTask("c", nil)))
+	assert.True(t, ran)
+}
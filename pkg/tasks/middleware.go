@@ -0,0 +1,231 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"github.com/Dissociable/Couploan/logger"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/hibiken/asynq"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// OutcomeSucceeded is the outcome of a task handled without an error
+	OutcomeSucceeded = "succeeded"
+	// OutcomeFailed is the outcome of a task that failed, it's retried unless it ran out of retries or skipped them
+	OutcomeFailed = "failed"
+	// OutcomeRateLimited is the outcome of a task that failed with a RateLimitError, it's retried without counting
+	// as a failure
+	OutcomeRateLimited = "rate_limited"
+	// OutcomePanicked is the outcome of a task whose handler panicked
+	OutcomePanicked = "panicked"
+)
+
+// PanicError is the error of a task whose handler panicked
+type PanicError struct {
+	Value any
+	// Stack is the stack trace of the panic
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Outcome returns the outcome of a task handled with the error
+func Outcome(err error) string {
+	var panicErr *PanicError
+	switch {
+	case err == nil:
+		return OutcomeSucceeded
+	case errors.As(err, &panicErr):
+		return OutcomePanicked
+	case IsRateLimitError(err):
+		return OutcomeRateLimited
+	}
+	return OutcomeFailed
+}
+
+// Recover recovers the panics of the handlers into a PanicError, logging their stack trace
+func Recover() asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(
+			func(ctx context.Context, task *asynq.Task) (err error) {
+				defer func() {
+					if v := recover(); v != nil {
+						err = &PanicError{Value: v, Stack: debug.Stack()}
+						logger.FromCtx(ctx).Error(
+							"recovered from panic in task handler",
+							zap.Any("panic", v), zap.ByteString("stack", err.(*PanicError).Stack),
+						)
+					}
+				}()
+				return next.ProcessTask(ctx, task)
+			},
+		)
+	}
+}
+
+// rateLimitedTTL is how long the rate limited attempts of a task are remembered since its last one
+const rateLimitedTTL = 24 * time.Hour
+
+// RateLimitRequests maps the errors of the ve requests of the handlers that are worth retrying later to a
+// RateLimitError, see RateLimitErrorFromRequest
+//
+// As asynq doesn't count the rate limited attempts as retries, a task is only rate limited maxAttempts times by
+// this instance, its later errors are returned as is, so a dead proxy or a host that is always down still runs the
+// task out of its retries.
+func RateLimitRequests(maxAttempts int) asynq.MiddlewareFunc {
+	var mu sync.Mutex
+	// attempts are the rate limited attempts by the task id, swept of the forgotten ones every minute
+	attempts := map[string]*rateLimitedAttempts{}
+	var swept time.Time
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(
+			func(ctx context.Context, task *asynq.Task) error {
+				err := next.ProcessTask(ctx, task)
+				id, _ := asynq.GetTaskID(ctx)
+				mu.Lock()
+				defer mu.Unlock()
+				now := time.Now()
+				if now.Sub(swept) > time.Minute {
+					swept = now
+					for taskID, a := range attempts {
+						if now.Sub(a.last) > rateLimitedTTL {
+							delete(attempts, taskID)
+						}
+					}
+				}
+				if err == nil {
+					delete(attempts, id)
+					return nil
+				}
+				if IsRateLimitError(err) {
+					return err
+				}
+				rateLimitErr := RateLimitErrorFromRequest(err)
+				if !IsRateLimitError(rateLimitErr) {
+					return err
+				}
+				a, ok := attempts[id]
+				if !ok {
+					a = &rateLimitedAttempts{}
+					attempts[id] = a
+				}
+				a.last = now
+				if a.count >= maxAttempts {
+					return err
+				}
+				a.count++
+				return rateLimitErr
+			},
+		)
+	}
+}
+
+type rateLimitedAttempts struct {
+	count int
+	last  time.Time
+}
+
+// Log attaches a logger of the task to the context of its handler, see logger.FromCtx, and logs its outcome
+func Log(base *zap.Logger) asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(
+			func(ctx context.Context, task *asynq.Task) error {
+				id, _ := asynq.GetTaskID(ctx)
+				queue, _ := asynq.GetQueueName(ctx)
+				retry, _ := asynq.GetRetryCount(ctx)
+				maxRetry, _ := asynq.GetMaxRetry(ctx)
+				l := base.With(
+					zap.String("task_id", id),
+					zap.String("task_type", task.Type()),
+					zap.String("queue", queue),
+					zap.Int("retry", retry),
+					zap.Int("max_retry", maxRetry),
+				)
+				ctx = logger.WithCtx(ctx, l)
+
+				l.Debug("processing task")
+				start := time.Now()
+				err := next.ProcessTask(ctx, task)
+				outcome := Outcome(err)
+				fields := []zap.Field{zap.Duration("duration", time.Since(start)), zap.String("outcome", outcome)}
+				switch outcome {
+				case OutcomeSucceeded:
+					l.Info("processed task", fields...)
+				case OutcomeRateLimited:
+					l.Info("task is rate limited", append(fields, zap.Error(err))...)
+				default:
+					l.Error("failed to process task", append(fields, zap.Error(err))...)
+				}
+				return err
+			},
+		)
+	}
+}
+
+// TaskMetrics counts the outcomes and durations of the processed tasks, by their type
+type TaskMetrics struct {
+	mu    sync.Mutex
+	types map[string]*services.TaskTypeStats
+}
+
+// NewTaskMetrics creates empty task metrics
+func NewTaskMetrics() *TaskMetrics {
+	return &TaskMetrics{types: map[string]*services.TaskTypeStats{}}
+}
+
+// Observe records a task of the type processed in d with the error
+func (m *TaskMetrics) Observe(typ string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.types[typ]
+	if !ok {
+		s = &services.TaskTypeStats{}
+		m.types[typ] = s
+	}
+	s.Processed++
+	s.Duration += d
+	s.MaxDuration = max(s.MaxDuration, d)
+	switch Outcome(err) {
+	case OutcomeSucceeded:
+		s.Succeeded++
+	case OutcomeRateLimited:
+		s.RateLimited++
+	case OutcomePanicked:
+		s.Panicked++
+		s.Failed++
+	default:
+		s.Failed++
+	}
+}
+
+// Stats returns a snapshot of the metrics, by the task type
+func (m *TaskMetrics) Stats() map[string]services.TaskTypeStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make(map[string]services.TaskTypeStats, len(m.types))
+	for typ, s := range m.types {
+		stats[typ] = *s
+	}
+	return stats
+}
+
+// Middleware records the duration and outcome of every task
+func (m *TaskMetrics) Middleware() asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(
+			func(ctx context.Context, task *asynq.Task) error {
+				start := time.Now()
+				err := next.ProcessTask(ctx, task)
+				m.Observe(task.Type(), time.Since(start), err)
+				return err
+			},
+		)
+	}
+}
@@ -0,0 +1,119 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/logger"
+	"github.com/Dissociable/Couploan/ve"
+	"github.com/hibiken/asynq"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMiddleware(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	metrics := NewTaskMetrics()
+	mux := asynq.NewServeMux()
+	mux.Use(Log(zap.New(core)), metrics.Middleware(), Recover(), RateLimitRequests(10))
+	mux.HandleFunc(
+		"ok", func(ctx context.Context, task *asynq.Task) error {
+			logger.FromCtx(ctx).Info("handling")
+			return nil
+		},
+	)
+	mux.HandleFunc(
+		"limited", func(ctx context.Context, task *asynq.Task) error {
+			return &RateLimitError{RetryIn: time.Second}
+		},
+	)
+	mux.HandleFunc(
+		"proxy", func(ctx context.Context, task *asynq.Task) error {
+			return errors.Wrap(&ve.ProxyError{RequestError: ve.RequestError{ProxyID: "http://127.0.0.1:8080"}}, "login")
+		},
+	)
+	mux.HandleFunc(
+		"fail", func(ctx context.Context, task *asynq.Task) error {
+			return errors.New("failed")
+		},
+	)
+	mux.HandleFunc(
+		"panic", func(ctx context.Context, task *asynq.Task) error {
+			panic("boom")
+		},
+	)
+
+	ctx := context.Background()
+	require.NoError(t, mux.ProcessTask(ctx, asynq.NewTask("ok", nil)))
+	require.NoError(t, mux.ProcessTask(ctx, asynq.NewTask("ok", nil)))
+	assert.True(t, IsRateLimitError(mux.ProcessTask(ctx, asynq.NewTask("limited", nil))))
+	err := mux.ProcessTask(ctx, asynq.NewTask("proxy", nil))
+	var rateLimitErr *RateLimitError
+	require.ErrorAs(t, err, &rateLimitErr)
+	assert.Equal(t, defaultProxyRetryIn, rateLimitErr.RetryIn)
+	assert.EqualError(t, mux.ProcessTask(ctx, asynq.NewTask("fail", nil)), "failed")
+	err = mux.ProcessTask(ctx, asynq.NewTask("panic", nil))
+	var panicErr *PanicError
+	require.ErrorAs(t, err, &panicErr)
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+
+	stats := metrics.Stats()
+	assert.EqualValues(t, 2, stats["ok"].Processed)
+	assert.EqualValues(t, 2, stats["ok"].Succeeded)
+	assert.EqualValues(t, 1, stats["limited"].RateLimited)
+	assert.EqualValues(t, 1, stats["proxy"].RateLimited)
+	assert.EqualValues(t, 0, stats["proxy"].Failed)
+	assert.EqualValues(t, 1, stats["fail"].Failed)
+	assert.EqualValues(t, 1, stats["panic"].Panicked)
+	assert.EqualValues(t, 1, stats["panic"].Failed)
+
+	handling := logs.FilterMessage("handling").All()
+	require.Len(t, handling, 2)
+	assert.Equal(t, "ok", handling[0].ContextMap()["task_type"])
+	assert.Len(t, logs.FilterMessage("recovered from panic in task handler").All(), 1)
+	assert.Len(t, logs.FilterMessage("failed to process task").All(), 2)
+	assert.Len(t, logs.FilterMessage("task is rate limited").All(), 2)
+}
+
+func TestRateLimitRequests(t *testing.T) {
+	var fail error = &ve.StatusError{StatusCode: 503, RetryAfter: time.Second}
+	h := RateLimitRequests(2)(
+		asynq.HandlerFunc(
+			func(ctx context.Context, task *asynq.Task) error {
+				return fail
+			},
+		),
+	)
+	ctx := context.Background()
+	task := asynq.NewTask("ve", nil)
+	assert.True(t, IsRateLimitError(h.ProcessTask(ctx, task)))
+	assert.True(t, IsRateLimitError(h.ProcessTask(ctx, task)))
+	err := h.ProcessTask(ctx, task)
+	assert.False(t, IsRateLimitError(err), "the task must run out of its rate limited attempts")
+	assert.ErrorIs(t, err, ve.ErrStatus)
+
+	fail = nil
+	require.NoError(t, h.ProcessTask(ctx, task))
+	fail = &ve.ProxyError{}
+	assert.True(t, IsRateLimitError(h.ProcessTask(ctx, task)), "a success resets the attempts")
+}
+
+func TestAsynqLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	l := NewAsynqLogger(zap.New(core))
+	l.Error("failed to ", "start")
+	l.Warn("warning")
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	assert.Equal(t, "failed to start", entries[0].Message)
+	assert.Empty(t, entries[0].Context)
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+}
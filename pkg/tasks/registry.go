@@ -0,0 +1,104 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/hibiken/asynq"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+)
+
+// resultWriterKey is the context key of the result writer of the task being handled
+type resultWriterKey struct{}
+
+var (
+	handlersMu sync.RWMutex
+	// handlers are the registered handlers, by their task type
+	handlers = map[string]asynq.Handler{}
+)
+
+// Register registers the handler of the tasks of the type, their JSON payload, as set by services.Task.Payload,
+// is decoded into a P before the handler is called
+//
+// The options are the defaults of the tasks of the type. It panics when the type is already registered.
+func Register[P any](typ string, handler func(ctx context.Context, payload P) error, opts services.TaskTypeOptions) {
+	if typ == "" || handler == nil {
+		panic("tasks: Register requires a task type and a handler")
+	}
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	if _, ok := handlers[typ]; ok {
+		panic(fmt.Sprintf("tasks: task type %q is already registered", typ))
+	}
+	handlers[typ] = handle(handler)
+	services.RegisterTaskType(typ, opts)
+}
+
+// handle returns an asynq handler decoding the payload of the task into a P
+//
+// A payload which can't be decoded is never retried. The result writer of the task is passed to the handler
+// through the context, see WriteResult.
+func handle[P any](handler func(ctx context.Context, payload P) error) asynq.HandlerFunc {
+	return func(ctx context.Context, task *asynq.Task) error {
+		if w := task.ResultWriter(); w != nil {
+			ctx = context.WithValue(ctx, resultWriterKey{}, w)
+		}
+		var payload P
+		if len(task.Payload()) > 0 {
+			if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+				return errors.Wrapf(asynq.SkipRetry, "failed to decode payload of task %s: %v", task.Type(), err)
+			}
+		}
+		return handler(ctx, payload)
+	}
+}
+
+// WriteResult writes the result of the task being handled as JSON, it's reported by the task status api
+//
+// The result is only kept as long as the retention of the task, see services.TaskTypeOptions.Retention.
+func WriteResult(ctx context.Context, result any) error {
+	w, ok := ctx.Value(resultWriterKey{}).(*asynq.ResultWriter)
+	if !ok {
+		return errors.New("no task result writer in context")
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal task result")
+	}
+	if _, err = w.Write(data); err != nil {
+		return errors.Wrapf(err, "failed to write result of task %s", w.TaskID())
+	}
+	return nil
+}
+
+// NewServeMux returns a mux of the registered handlers
+func NewServeMux() *asynq.ServeMux {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	mux := asynq.NewServeMux()
+	for typ, handler := range handlers {
+		mux.Handle(typ, handler)
+	}
+	return mux
+}
+
+// RegisteredQueues returns the queues of the registered task types, sorted
+func RegisteredQueues() []string {
+	seen := map[string]bool{}
+	var queues []string
+	for _, options := range services.TaskTypes() {
+		queue := options.Queue
+		if queue == "" {
+			queue = "default"
+		}
+		if !seen[queue] {
+			seen[queue] = true
+			queues = append(queues, queue)
+		}
+	}
+	sort.Strings(queues)
+	return queues
+}
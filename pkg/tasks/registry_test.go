@@ -0,0 +1,46 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	type payload struct {
+		UserID int `json:"user_id"`
+	}
+	var got payload
+	var resultErr error
+	Register(
+		"test:register", func(ctx context.Context, p payload) error {
+			got = p
+			resultErr = WriteResult(ctx, p)
+			return nil
+		}, services.TaskTypeOptions{Queue: "register", Timeout: time.Minute},
+	)
+
+	options, ok := services.LookupTaskType("test:register")
+	require.True(t, ok)
+	assert.Equal(t, "register", options.Queue)
+	assert.Contains(t, RegisteredQueues(), "register")
+
+	mux := NewServeMux()
+	require.NoError(t, mux.ProcessTask(context.Background(), asynq.NewTask("test:register", []byte(`{"user_id":7}`))))
+	assert.Equal(t, payload{UserID: 7}, got)
+	assert.Error(t, resultErr, "a task not dequeued by a server has no result writer")
+
+	err := mux.ProcessTask(context.Background(), asynq.NewTask("test:register", []byte(`{`)))
+	assert.ErrorIs(t, err, asynq.SkipRetry)
+
+	assert.Panics(
+		t, func() {
+			Register("test:register", func(ctx context.Context, p payload) error { return nil }, services.TaskTypeOptions{})
+		},
+	)
+}
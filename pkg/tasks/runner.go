@@ -0,0 +1,285 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/hibiken/asynq"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	// RunnerStarting is the state of a runner connecting for the first time
+	RunnerStarting = "starting"
+	// RunnerRunning is the state of a runner processing the tasks
+	RunnerRunning = "running"
+	// RunnerReconnecting is the state of a runner which lost or couldn't get its connection
+	RunnerReconnecting = "reconnecting"
+	// RunnerStopped is the state of a stopped runner
+	RunnerStopped = "stopped"
+)
+
+// ErrRunnerStarted is returned by TasksRunner.Start when the runner is already started
+var ErrRunnerStarted = errors.New("tasks runner is already started")
+
+type RunnerOptions struct {
+	// PingInterval is the interval of checking the connection to redis, defaults to 15s
+	PingInterval time.Duration
+	// PingTimeout is the timeout of connecting and of the pings, defaults to 5s
+	PingTimeout time.Duration
+	// MinBackoff and MaxBackoff bound the exponential delays between the reconnection attempts,
+	// default to 1s and 1m
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// TasksRunner runs the asynq server processing the tasks and the inspector of the queues on a shared redis pool,
+// reconnecting with backoff whenever the connection is lost
+type TasksRunner struct {
+	c       *services.Container
+	options RunnerOptions
+	// metrics are kept across the reconnections
+	metrics *TaskMetrics
+
+	mu        sync.RWMutex
+	pool      *SharedRedisPool
+	server    *asynq.Server
+	inspector *asynq.Inspector
+	health    services.TasksRunnerHealth
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewTasksRunner creates a runner of the tasks of the container, it's started via Start
+func NewTasksRunner(c *services.Container, options RunnerOptions) *TasksRunner {
+	if options.PingInterval <= 0 {
+		options.PingInterval = 15 * time.Second
+	}
+	if options.PingTimeout <= 0 {
+		options.PingTimeout = 5 * time.Second
+	}
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = time.Second
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = max(time.Minute, options.MinBackoff)
+	}
+	return &TasksRunner{
+		c:       c,
+		options: options,
+		metrics: NewTaskMetrics(),
+		health:  services.TasksRunnerHealth{State: RunnerStopped, Since: time.Now()},
+	}
+}
+
+// Start connects and starts processing the tasks in the background, it doesn't wait for the connection
+//
+// The runner keeps reconnecting until it's stopped via Stop or ctx is done.
+func (r *TasksRunner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return ErrRunnerStarted
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	r.setState(RunnerStarting, nil)
+	go r.run(ctx, r.done)
+	return nil
+}
+
+// Stop stops processing the tasks, waiting for the running ones up to the shutdown timeout of the tasks config
+// or until ctx is done
+func (r *TasksRunner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel = nil
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "failed to wait for the tasks runner to stop")
+	}
+}
+
+// Health returns the health of the runner
+func (r *TasksRunner) Health() services.TasksRunnerHealth {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.health
+}
+
+// Inspector returns the inspector of the queues, ErrInspectorNotStarted is returned while the runner isn't connected
+func (r *TasksRunner) Inspector() (*asynq.Inspector, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.inspector == nil {
+		return nil, ErrInspectorNotStarted
+	}
+	return r.inspector, nil
+}
+
+// Metrics returns the metrics of the processed tasks, by their type
+func (r *TasksRunner) Metrics() map[string]services.TaskTypeStats {
+	return r.metrics.Stats()
+}
+
+// Admin returns a queue admin on the inspector of the runner
+func (r *TasksRunner) Admin() (*QueueAdmin, error) {
+	inspector, err := r.Inspector()
+	if err != nil {
+		return nil, err
+	}
+	return NewQueueAdmin(inspector), nil
+}
+
+// setState sets the state of the runner, r.mu must be held
+func (r *TasksRunner) setState(state string, err error) {
+	if r.health.State != state {
+		r.health.Since = time.Now()
+	}
+	r.health.State = state
+	r.health.Healthy = state == RunnerRunning
+	if err != nil {
+		r.health.LastError = err.Error()
+	}
+}
+
+// run connects, watches the connection and reconnects until ctx is done
+func (r *TasksRunner) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	backoff := r.options.MinBackoff
+	for {
+		err := r.connect(ctx)
+		if err == nil {
+			backoff = r.options.MinBackoff
+			err = r.watch(ctx)
+			r.disconnect()
+		}
+		if ctx.Err() != nil {
+			r.mu.Lock()
+			r.setState(RunnerStopped, nil)
+			r.mu.Unlock()
+			return
+		}
+		r.c.Logger.Error(
+			"tasks runner disconnected, reconnecting", zap.Duration("backoff", backoff), zap.Error(err),
+		)
+		r.mu.Lock()
+		r.setState(RunnerReconnecting, err)
+		r.mu.Unlock()
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.mu.Lock()
+			r.setState(RunnerStopped, nil)
+			r.mu.Unlock()
+			return
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, r.options.MaxBackoff)
+	}
+}
+
+// connect connects to redis and starts the server and the inspector
+func (r *TasksRunner) connect(ctx context.Context) error {
+	cfg := r.c.Config
+	db := cfg.Cache.Database
+	if cfg.App.Environment == config.EnvTest {
+		db = cfg.Cache.TestDatabase
+	}
+	pool, err := NewSharedRedisPool(
+		SharedRedisPoolOpts{
+			DSN:      fmt.Sprintf("redis://%s:%d", cfg.Cache.Hostname, cfg.Cache.Port),
+			DB:       db,
+			Username: cfg.Cache.Username,
+			Password: cfg.Cache.Password,
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to create shared redis pool")
+	}
+	if err = r.ping(ctx, pool); err != nil {
+		_ = pool.Client.Close()
+		return err
+	}
+	limits, err := NewLimits(pool, r.c.Logger, cfg.Tasks.Limits)
+	if err != nil {
+		_ = pool.Client.Close()
+		return errors.Wrap(err, "failed to create task limits")
+	}
+	server := newServer(pool, r.c)
+	mux := newServeMux(r.c.Logger.Named("Tasks"), r.metrics, limits, cfg.Tasks.Retry.MaxRateLimited)
+	if err = server.Start(mux); err != nil {
+		_ = pool.Client.Close()
+		return errors.Wrap(err, "failed to start tasks runner server")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.health.State == RunnerReconnecting {
+		r.health.Reconnects++
+	}
+	r.pool = pool
+	r.server = server
+	r.inspector = asynq.NewInspector(pool)
+	r.health.LastPing = time.Now()
+	r.setState(RunnerRunning, nil)
+	return nil
+}
+
+// watch pings redis every PingInterval, it returns the error of the first failed ping or nil once ctx is done
+func (r *TasksRunner) watch(ctx context.Context) error {
+	ticker := time.NewTicker(r.options.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		r.mu.RLock()
+		pool := r.pool
+		r.mu.RUnlock()
+		if err := r.ping(ctx, pool); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.health.LastPing = time.Now()
+		r.mu.Unlock()
+	}
+}
+
+func (r *TasksRunner) ping(ctx context.Context, pool *SharedRedisPool) error {
+	ctx, cancel := context.WithTimeout(ctx, r.options.PingTimeout)
+	defer cancel()
+	return errors.Wrap(pool.Client.Ping(ctx).Err(), "failed to ping redis")
+}
+
+// disconnect shuts the server down, waiting for the running tasks, and closes the connection
+func (r *TasksRunner) disconnect() {
+	r.mu.Lock()
+	server, pool := r.server, r.pool
+	r.server, r.inspector, r.pool = nil, nil, nil
+	r.mu.Unlock()
+	if server != nil {
+		server.Shutdown()
+	}
+	if pool != nil {
+		// The server closes the shared client on shutdown already
+		_ = pool.Client.Close()
+	}
+}
+
+var _ services.TasksRunner = (*TasksRunner)(nil)
@@ -2,80 +2,67 @@ package tasks
 
 import (
 	"fmt"
-	"github.com/Dissociable/Couploan/config"
 	"github.com/Dissociable/Couploan/pkg/services"
 	"github.com/hibiken/asynq"
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
-	"log"
-	"time"
 )
 
-// limiter Rate is 10 events/sec and permits burst of at most 30 events.
-var limiter *rate.Limiter
-
-func StartTasksRunnerServer(
-	sharedRedisPool *SharedRedisPool, c *services.Container, async bool, srv *asynq.Server,
-) {
-	// limit 1 event per minute
-	// limiter = rate.NewLimiter(rate.Every(1*time.Minute), 2)
-
-	// Determine the database based on the environment
-	db := c.Config.Cache.Database
-	if c.Config.App.Environment == config.EnvTest {
-		db = c.Config.Cache.TestDatabase
-	}
-	// Build the worker server
+// newServer builds the asynq server of the tasks config on the shared redis pool
+func newServer(pool *SharedRedisPool, c *services.Container) *asynq.Server {
+	tasksConfig := c.Config.Tasks
 	logLevel := asynq.InfoLevel
-	// err := logLevel.Set(c.Config.App.LogLevel)
-	// if err != nil {
-	//	c.Logger.Error("failed to set asynq runner server's log level", zap.Error(err))
-	// }
-	asynqConfig := asynq.Config{
-		// See asynq.Config for all available options and explanation
-		Concurrency:    1,
-		IsFailure:      func(err error) bool { return !IsRateLimitError(err) },
-		RetryDelayFunc: retryDelay,
-		// RetryDelayFunc: func(n int, e error, tgUser *asynq.Task) time.Duration {
-		//	return 10 * time.Second
-		// },
-		Queues: map[string]int{
-			"post": 3,
-		},
-		Logger:                   NewAsynqLogger(c.Logger.Named(c.Config.App.Name + "TasksRunner")),
-		LogLevel:                 logLevel,
-		ShutdownTimeout:          2 * time.Minute,
-		DelayedTaskCheckInterval: 0,
-		GroupAggregator:          nil,
+	if tasksConfig.LogLevel != "" {
+		if err := logLevel.Set(tasksConfig.LogLevel); err != nil {
+			c.Logger.Error("failed to set asynq runner server's log level", zap.Error(err))
+		}
+	}
+	retryDelayFunc, err := retryDelay(tasksConfig.Retry)
+	if err != nil {
+		c.Logger.Error("failed to set asynq runner server's retry delay, using the default", zap.Error(err))
 	}
-	if sharedRedisPool != nil {
-		*srv = *asynq.NewServer(sharedRedisPool, asynqConfig)
-	} else {
-		*srv = *asynq.NewServer(
-			asynq.RedisClientOpt{
-				Addr:     fmt.Sprintf("%s:%d", c.Config.Cache.Hostname, c.Config.Cache.Port),
-				DB:       db,
-				Username: c.Config.Cache.Username,
-				Password: c.Config.Cache.Password,
-			}, asynqConfig,
-		)
+	queueWeights := make(map[string]int, len(tasksConfig.Queues))
+	for queue, priority := range tasksConfig.Queues {
+		queueWeights[queue] = priority
 	}
+	return asynq.NewServer(
+		pool, asynq.Config{
+			// See asynq.Config for all available options and explanation
+			Concurrency:              tasksConfig.Concurrency,
+			IsFailure:                func(err error) bool { return !IsRateLimitError(err) },
+			RetryDelayFunc:           retryDelayFunc,
+			Queues:                   queues(queueWeights),
+			StrictPriority:           tasksConfig.StrictPriority,
+			Logger:                   NewAsynqLogger(c.Logger.Named(c.Config.App.Name + "TasksRunner")),
+			LogLevel:                 logLevel,
+			ShutdownTimeout:          tasksConfig.ShutdownTimeout,
+			DelayedTaskCheckInterval: 0,
+			GroupAggregator:          nil,
+		},
+	)
+}
 
-	// Map task types to the handlers
-	mux := asynq.NewServeMux()
+// newServeMux returns the mux of the registered handlers
+//
+// The tasks are logged, measured and recovered from their panics, including the ones of the limits, before they
+// acquire the tokens of their limits, and the failed ve requests worth retrying later are rate limited up to
+// maxRateLimited times.
+func newServeMux(base *zap.Logger, metrics *TaskMetrics, limits *Limits, maxRateLimited int) *asynq.ServeMux {
+	mux := NewServeMux()
+	mux.Use(Log(base), metrics.Middleware(), Recover(), RateLimitRequests(maxRateLimited), limits.Middleware())
+	return mux
+}
 
-	// Start the worker server
-	if async {
-		if err := srv.Start(mux); err != nil {
-			log.Fatalf("could not run worker server: %v", err)
-		}
-	} else {
-		if err := srv.Run(mux); err != nil {
-			log.Fatalf("could not run worker server: %v", err)
+// queues adds the queues of the registered task types missing from weights, with a weight of 1
+func queues(weights map[string]int) map[string]int {
+	for _, queue := range RegisteredQueues() {
+		if _, ok := weights[queue]; !ok {
+			weights[queue] = 1
 		}
 	}
+	return weights
 }
 
+// AsynqLogger logs the messages of asynq on a zap logger
 type AsynqLogger struct {
 	BaseLogger *zap.Logger
 }
@@ -87,42 +74,28 @@ func NewAsynqLogger(base *zap.Logger) *AsynqLogger {
 	return asynqLogger
 }
 
-func (l *AsynqLogger) GetMessageAndFields(args ...interface{}) (msg string, fields []zap.Field) {
-	var firstMsg string
-	if len(args) > 0 {
-		// check if args is a string, then assign it to firstMsg
-		s, ok := args[0].(string)
-		if ok {
-			firstMsg = s
-		}
-	}
-	for i, arg := range args[1:] {
-		fields = append(fields, zap.Any(fmt.Sprintf("field_%d", i), arg))
-	}
-	return firstMsg, fields
+// GetMessage formats the args of asynq into a message, the same way as fmt.Sprint
+func (l *AsynqLogger) GetMessage(args ...interface{}) string {
+	return fmt.Sprint(args...)
 }
 
 func (l *AsynqLogger) Debug(args ...interface{}) {
-	m, f := l.GetMessageAndFields(args...)
-	l.BaseLogger.Debug(m, f...)
+	l.BaseLogger.Debug(l.GetMessage(args...))
 }
 
 func (l *AsynqLogger) Info(args ...interface{}) {
-	m, f := l.GetMessageAndFields(args...)
-	l.BaseLogger.Info(m, f...)
+	l.BaseLogger.Info(l.GetMessage(args...))
 }
 
 func (l *AsynqLogger) Warn(args ...interface{}) {
-	m, f := l.GetMessageAndFields(args...)
-	l.BaseLogger.Warn(m, f...)
+	l.BaseLogger.Warn(l.GetMessage(args...))
 }
 
 func (l *AsynqLogger) Error(args ...interface{}) {
-	m, f := l.GetMessageAndFields(args...)
-	l.BaseLogger.Warn(m, f...)
+	l.BaseLogger.Error(l.GetMessage(args...))
 }
 
+// Fatal logs the message and exits, as asynq expects
 func (l *AsynqLogger) Fatal(args ...interface{}) {
-	m, f := l.GetMessageAndFields(args...)
-	l.BaseLogger.Warn(m, f...)
+	l.BaseLogger.Fatal(l.GetMessage(args...))
 }
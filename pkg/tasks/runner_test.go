@@ -0,0 +1,44 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTasksRunner_Unreachable(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Cache.Hostname = "127.0.0.1"
+	// Nothing listens on the port 1
+	cfg.Cache.Port = 1
+	container := &services.Container{Config: cfg, Logger: zap.NewNop()}
+
+	r := NewTasksRunner(
+		container, RunnerOptions{PingTimeout: 100 * time.Millisecond, MinBackoff: 10 * time.Millisecond},
+	)
+	assert.Equal(t, RunnerStopped, r.Health().State)
+
+	require.NoError(t, r.Start(context.Background()))
+	assert.ErrorIs(t, r.Start(context.Background()), ErrRunnerStarted)
+
+	assert.Eventually(
+		t, func() bool { return r.Health().State == RunnerReconnecting }, 5*time.Second, 10*time.Millisecond,
+	)
+	health := r.Health()
+	assert.False(t, health.Healthy)
+	assert.NotEmpty(t, health.LastError)
+	_, err := r.Inspector()
+	assert.ErrorIs(t, err, ErrInspectorNotStarted)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, r.Stop(ctx))
+	assert.Equal(t, RunnerStopped, r.Health().State)
+	require.NoError(t, r.Stop(ctx))
+}
@@ -0,0 +1,210 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+// schedulerLockKey is the key of the lock held by the instance leading the scheduling
+const schedulerLockKey = "tasks:scheduler:leader"
+
+var (
+	// renewLockScript extends the ttl of the lock when it's still held by the instance
+	renewLockScript = redis.NewScript(
+		`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`,
+	)
+	// releaseLockScript deletes the lock when it's still held by the instance
+	releaseLockScript = redis.NewScript(
+		`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`,
+	)
+)
+
+// Scheduler enqueues the periodic tasks of the task client, see services.Task.Periodic
+//
+// Every instance runs one, but only the one holding the scheduler lock in redis leads the scheduling, the others
+// take it over once the lock expires, e.g., when the leader is gone.
+type Scheduler struct {
+	c        *services.Container
+	client   *redis.Client
+	rco      asynq.RedisConnOpt
+	id       string
+	ttl      time.Duration
+	location *time.Location
+
+	mu sync.Mutex
+	// scheduler is the asynq scheduler, only set while leading
+	scheduler *asynq.Scheduler
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewScheduler creates a scheduler of the periodic tasks of the container, the lock is held via the client
+func NewScheduler(c *services.Container, client *redis.Client) (*Scheduler, error) {
+	cfg := c.Config
+	location, err := time.LoadLocation(cfg.Tasks.Timezone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load timezone %s of the tasks", cfg.Tasks.Timezone)
+	}
+	ttl := cfg.Tasks.SchedulerLockTTL
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	db := cfg.Cache.Database
+	if cfg.App.Environment == config.EnvTest {
+		db = cfg.Cache.TestDatabase
+	}
+	host, _ := os.Hostname()
+	return &Scheduler{
+		c:      c,
+		client: client,
+		rco: asynq.RedisClientOpt{
+			Addr:     fmt.Sprintf("%s:%d", cfg.Cache.Hostname, cfg.Cache.Port),
+			Username: cfg.Cache.Username,
+			Password: cfg.Cache.Password,
+			DB:       db,
+		},
+		id:       fmt.Sprintf("%s:%d:%s", host, os.Getpid(), uuid.NewString()),
+		ttl:      ttl,
+		location: location,
+	}, nil
+}
+
+// Start starts competing for the lead of the scheduling in the background
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return errors.New("tasks scheduler is already started")
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	go s.run(ctx, s.done)
+	return nil
+}
+
+// Stop stops the scheduling and releases the lock, so another instance takes it over right away
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel = nil
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "failed to wait for the tasks scheduler to stop")
+	}
+}
+
+// IsLeader returns whether the instance is leading the scheduling
+func (s *Scheduler) IsLeader() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scheduler != nil
+}
+
+// run acquires or renews the lock every third of its ttl, leading the scheduling while it's held
+func (s *Scheduler) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	for {
+		s.elect(ctx)
+		select {
+		case <-ctx.Done():
+			s.resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// elect renews the lock while leading and tries to acquire it otherwise
+func (s *Scheduler) elect(ctx context.Context) {
+	if s.IsLeader() {
+		renewed, err := renewLockScript.Run(ctx, s.client, []string{schedulerLockKey}, s.id, s.ttl.Milliseconds()).Int()
+		if err != nil || renewed == 0 {
+			s.c.Logger.Warn("lost the lead of the tasks scheduling", zap.Error(err))
+			s.demote()
+		}
+		return
+	}
+	acquired, err := s.client.SetNX(ctx, schedulerLockKey, s.id, s.ttl).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			s.c.Logger.Warn("failed to acquire the tasks scheduler lock", zap.Error(err))
+		}
+		return
+	}
+	if acquired {
+		if err = s.promote(); err != nil {
+			s.c.Logger.Error("failed to start the tasks scheduler", zap.Error(err))
+			s.release()
+		}
+	}
+}
+
+// promote starts an asynq scheduler of the periodic tasks
+func (s *Scheduler) promote() error {
+	scheduler := asynq.NewScheduler(
+		s.rco, &asynq.SchedulerOpts{
+			Logger:   NewAsynqLogger(s.c.Logger.Named(s.c.Config.App.Name + "TasksScheduler")),
+			Location: s.location,
+		},
+	)
+	for _, task := range s.c.Tasks.PeriodicTasks() {
+		if _, err := scheduler.Register(task.Spec, task.Task); err != nil {
+			s.c.Logger.Error("failed to register periodic task", zap.String("id", task.ID), zap.Error(err))
+		}
+	}
+	if err := scheduler.Start(); err != nil {
+		return errors.Wrap(err, "failed to start asynq scheduler")
+	}
+	s.mu.Lock()
+	s.scheduler = scheduler
+	s.mu.Unlock()
+	s.c.Logger.Info("leading the tasks scheduling", zap.String("id", s.id))
+	return nil
+}
+
+// demote shuts the asynq scheduler down
+func (s *Scheduler) demote() {
+	s.mu.Lock()
+	scheduler := s.scheduler
+	s.scheduler = nil
+	s.mu.Unlock()
+	if scheduler != nil {
+		scheduler.Shutdown()
+	}
+}
+
+// resign stops leading the scheduling and releases the lock
+func (s *Scheduler) resign() {
+	if s.IsLeader() {
+		s.demote()
+		s.release()
+	}
+}
+
+// release deletes the lock when it's held by the instance
+func (s *Scheduler) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := releaseLockScript.Run(ctx, s.client, []string{schedulerLockKey}, s.id).Err(); err != nil {
+		s.c.Logger.Warn("failed to release the tasks scheduler lock", zap.Error(err))
+	}
+}
@@ -0,0 +1,53 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewScheduler_Timezone(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tasks.Timezone = "Mars/Olympus"
+	_, err := NewScheduler(&services.Container{Config: cfg}, nil)
+	assert.Error(t, err)
+
+	cfg.Tasks.Timezone = "Asia/Tehran"
+	s, err := NewScheduler(&services.Container{Config: cfg}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tehran", s.location.String())
+	assert.Equal(t, 30*time.Second, s.ttl)
+}
+
+func TestScheduler_Failover(t *testing.T) {
+	cfg := *c.Config
+	cfg.Tasks.SchedulerLockTTL = 900 * time.Millisecond
+	newScheduler := func() *Scheduler {
+		s, err := NewScheduler(
+			&services.Container{Config: &cfg, Logger: c.Logger, Tasks: c.Tasks, Cache: c.Cache}, c.Cache.Client,
+		)
+		require.NoError(t, err)
+		return s
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	leader := newScheduler()
+	require.NoError(t, leader.Start(ctx))
+	assert.Eventually(t, leader.IsLeader, 3*time.Second, 50*time.Millisecond)
+
+	follower := newScheduler()
+	require.NoError(t, follower.Start(ctx))
+	time.Sleep(time.Second)
+	assert.False(t, follower.IsLeader(), "the lock is held by the leader")
+
+	require.NoError(t, leader.Stop(ctx))
+	assert.False(t, leader.IsLeader())
+	assert.Eventually(t, follower.IsLeader, 3*time.Second, 50*time.Millisecond)
+	require.NoError(t, follower.Stop(ctx))
+}
@@ -1,11 +1,66 @@
 package tasks
 
-import "github.com/Dissociable/Couploan/pkg/services"
+import (
+	"context"
+	"encoding/json"
+	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/pkg/errors"
+	"sort"
+)
 
-func StartTasksRunner(c *services.Container, async bool) {
-	// Determine the database based on the environment
-	ReconnectRedisPool(c, async)
+// StartTasksRunner starts a runner of the tasks of the container in the background and stops it on the shutdown
+// of the container, the runner keeps reconnecting to redis until then, see TasksRunner
+func StartTasksRunner(ctx context.Context, c *services.Container) (*TasksRunner, error) {
+	r := NewTasksRunner(c, RunnerOptions{})
+	if err := r.Start(ctx); err != nil {
+		return nil, err
+	}
+	c.TasksRunner = r
+	c.OnShutdown(r.Stop)
+	return r, nil
+}
+
+// StartScheduler declares the periodic tasks of the tasks config and starts a scheduler of the periodic tasks
+// of the container in the background, it's stopped on the shutdown of the container, see Scheduler
+//
+// The periodic tasks declared in code must be saved before it's started.
+func StartScheduler(ctx context.Context, c *services.Container) (*Scheduler, error) {
+	if err := declarePeriodic(c); err != nil {
+		return nil, err
+	}
+	s, err := NewScheduler(c, c.Cache.Client)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.Start(ctx); err != nil {
+		return nil, err
+	}
+	c.OnShutdown(s.Stop)
+	return s, nil
+}
 
-	// Keep watching the redis client and pinging it, if it fails, try to reconnect
-	PoolWatchdog(c)
+// declarePeriodic saves the periodic tasks of the tasks config
+func declarePeriodic(c *services.Container) error {
+	names := make([]string, 0, len(c.Config.Tasks.Periodic))
+	for name := range c.Config.Tasks.Periodic {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := c.Config.Tasks.Periodic[name]
+		task := c.Tasks.New(p.Type).Periodic(p.Cron).Timezone(p.Timezone)
+		if p.Queue != "" {
+			task.Queue(p.Queue)
+		}
+		if p.Payload != "" {
+			if !json.Valid([]byte(p.Payload)) {
+				return errors.Errorf("periodic task %s has an invalid JSON payload", name)
+			}
+			task.Payload(json.RawMessage(p.Payload))
+		}
+		if _, err := task.Save(); err != nil {
+			return errors.Wrapf(err, "failed to declare periodic task %s", name)
+		}
+	}
+	return nil
 }
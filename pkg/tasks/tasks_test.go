@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -22,9 +23,9 @@ func TestMain(m *testing.M) {
 	c = services.NewContainer()
 
 	// Start the scheduler service to queue periodic tasks
-	StartTasksRunner(c, true)
-
-	// StartTasksRunnerServer(c, true)
+	if _, err := StartTasksRunner(context.Background(), c); err != nil {
+		panic(err)
+	}
 
 	// Run tests
 	exitVal := m.Run()
@@ -1,75 +1,64 @@
 package tasks
 
 import (
-	"context"
 	"fmt"
 	"github.com/Dissociable/Couploan/config"
-	"github.com/Dissociable/Couploan/pkg/services"
+	"github.com/Dissociable/Couploan/ve"
 	"github.com/hibiken/asynq"
-	"github.com/hibiken/asynq/x/rate"
 	"github.com/pkg/errors"
-	"go.uber.org/zap"
+	"net/http"
+	"strings"
 	"time"
 )
 
-func PoolWatchdog(c *services.Container) {
-	go func(c *services.Container) {
-		checkInterval := 15 * time.Second
-		for {
-			time.Sleep(checkInterval)
-			if err := sharedRedisPool.Client.Ping(context.Background()).Err(); err != nil {
-				c.Logger.Error("redis client disconnected, trying to reconnect...", zap.Error(err))
-				ReconnectRedisPool(c, true)
-			}
-		}
-	}(c)
+type RateLimitError struct {
+	RetryIn time.Duration
+	// Err is the error that caused the rate limit, optional
+	Err error
 }
 
-func ReconnectRedisPool(c *services.Container, async bool) {
-	var err error
-	db := c.Config.Cache.Database
-	if c.Config.App.Environment == config.EnvTest {
-		db = c.Config.Cache.TestDatabase
-	}
-	if asynqServer != nil {
-		asynqServer.Shutdown()
-	}
-	// Close
-	if sharedRedisPool != nil {
-		_ = sharedRedisPool.Client.Close()
-	}
-	// Reconnect
-	sharedRedisPool, err = NewSharedRedisPool(
-		SharedRedisPoolOpts{
-			DSN:      fmt.Sprintf("redis://%s:%d", c.Config.Cache.Hostname, c.Config.Cache.Port),
-			DB:       db,
-			Username: c.Config.Cache.Username,
-			Password: c.Config.Cache.Password,
-		},
-	)
-	if err != nil {
-		c.Logger.Fatal("failed to create shared redis pool", zap.Error(err))
+func (e *RateLimitError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("rate limited (retry in  %v): %v", e.RetryIn, e.Err)
 	}
-	time.Sleep(5 * time.Second)
-	InitializeSemaphore("global", 1)
-	asynqServer = new(asynq.Server)
-	StartTasksRunnerServer(sharedRedisPool, c, async, asynqServer)
-	asynqInspector = new(asynq.Inspector)
-	StartInspector(sharedRedisPool, c, asynqInspector)
-	time.Sleep(5 * time.Second)
+	return fmt.Sprintf("rate limited (retry in  %v)", e.RetryIn)
 }
 
-// InitializeSemaphore initializes the semaphore
-func InitializeSemaphore(scope string, maxTokens int) {
-	Semaphore = rate.NewSemaphore(sharedRedisPool, scope, maxTokens)
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
 }
 
-type RateLimitError struct {
-	RetryIn time.Duration
-}
+const (
+	// defaultStatusRetryIn is the delay of retrying a 429 or 503 that has no Retry-After
+	defaultStatusRetryIn = 30 * time.Second
+	// defaultProxyRetryIn is the delay of retrying after a proxy failure, in hope of getting a working one
+	defaultProxyRetryIn = 10 * time.Second
+)
 
-func (e *RateLimitError) Error() string {
-	return fmt.Sprintf("rate limited (retry in  %v)", e.RetryIn)
+// RateLimitErrorFromRequest maps the request errors of ve that are worth retrying later to a RateLimitError,
+// so they are not counted as failures of the task, the other errors are returned as is
+//
+// 429 and 503 are retried after their Retry-After, open circuits after their cooldown
+// and proxy failures after a short delay
+func RateLimitErrorFromRequest(err error) error {
+	var statusErr *ve.StatusError
+	if errors.As(err, &statusErr) &&
+		(statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == http.StatusServiceUnavailable) {
+		retryIn := statusErr.RetryAfter
+		if retryIn <= 0 {
+			retryIn = defaultStatusRetryIn
+		}
+		return &RateLimitError{RetryIn: retryIn, Err: err}
+	}
+	var circuitErr *ve.CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return &RateLimitError{RetryIn: circuitErr.RetryIn, Err: err}
+	}
+	var proxyErr *ve.ProxyError
+	if errors.As(err, &proxyErr) {
+		return &RateLimitError{RetryIn: defaultProxyRetryIn, Err: err}
+	}
+	return err
 }
 
 func IsRateLimitError(err error) bool {
@@ -78,10 +67,34 @@ func IsRateLimitError(err error) bool {
 	return ok
 }
 
-func retryDelay(n int, err error, task *asynq.Task) time.Duration {
-	var rateLimitErr *RateLimitError
-	if errors.As(err, &rateLimitErr) {
-		return rateLimitErr.RetryIn
+// retryDelay returns the delay between the retries of the policy, the rate limited tasks are retried after their RetryIn
+func retryDelay(cfg config.TasksRetry) (asynq.RetryDelayFunc, error) {
+	var delay asynq.RetryDelayFunc
+	var err error
+	switch strings.ToLower(cfg.Policy) {
+	case "", "exponential":
+		delay = asynq.DefaultRetryDelayFunc
+	case "linear":
+		delay = func(n int, _ error, _ *asynq.Task) time.Duration {
+			return time.Duration(n+1) * cfg.Delay
+		}
+	case "constant":
+		delay = func(int, error, *asynq.Task) time.Duration {
+			return cfg.Delay
+		}
+	default:
+		err = errors.Errorf("unknown retry policy %q", cfg.Policy)
+		delay = asynq.DefaultRetryDelayFunc
 	}
-	return asynq.DefaultRetryDelayFunc(n, err, task)
+	return func(n int, err error, task *asynq.Task) time.Duration {
+		var rateLimitErr *RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			return rateLimitErr.RetryIn
+		}
+		d := delay(n, err, task)
+		if cfg.MaxDelay > 0 && d > cfg.MaxDelay {
+			d = cfg.MaxDelay
+		}
+		return d
+	}, err
 }
@@ -0,0 +1,34 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/config"
+	"github.com/hibiken/asynq"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryDelay(t *testing.T) {
+	task := asynq.NewTask("test", nil)
+	failure := errors.New("failure")
+
+	linear, err := retryDelay(config.TasksRetry{Policy: "linear", Delay: 10 * time.Second, MaxDelay: 25 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, linear(0, failure, task))
+	assert.Equal(t, 20*time.Second, linear(1, failure, task))
+	assert.Equal(t, 25*time.Second, linear(5, failure, task), "the delay is capped")
+	assert.Equal(
+		t, time.Minute, linear(0, &RateLimitError{RetryIn: time.Minute}, task),
+		"the rate limited tasks are retried after their RetryIn",
+	)
+
+	constant, err := retryDelay(config.TasksRetry{Policy: "Constant", Delay: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, constant(7, failure, task))
+
+	_, err = retryDelay(config.TasksRetry{Policy: "random"})
+	assert.Error(t, err)
+}
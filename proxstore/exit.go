@@ -0,0 +1,217 @@
+package proxstore
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrExitCountryMismatch is returned when the proxy exits from another country than the one it claims
+var ErrExitCountryMismatch = errors.New("proxy exit country mismatch")
+
+// DefaultExitHistorySize is the size of the exit history enabled via [Proxy.EnableExitHistory] with size 0
+const DefaultExitHistorySize = 32
+
+// Exit is the exit of a proxy as observed through it
+type Exit struct {
+	IP string
+	// Country is the ISO 3166-1 alpha-2 code of the ip, empty if unknown
+	Country      string
+	ASN          uint
+	Organization string
+	// Source is the endpoint that echoed the ip
+	Source     string
+	ObservedAt time.Time
+}
+
+// RotationStats describes how well a proxy rotates its exit ip, from its exit history
+type RotationStats struct {
+	// Observations is the number of the exits in the history
+	Observations int
+	UniqueIPs    int
+	// Diversity is UniqueIPs / Observations, 1 when every observation had another ip
+	Diversity float64
+	// Releases is the number of times the proxy was released, e.g., via [ProxStore.ReleaseProxy]
+	Releases int
+	// FailedRotations is the number of releases after which the proxy kept the same exit ip
+	FailedRotations int
+}
+
+type exitState struct {
+	mu   sync.Mutex
+	exit *Exit
+	// history is a ring buffer of the observed exits, nil if the history is disabled
+	history         []Exit
+	next            int
+	full            bool
+	releases        int
+	failedRotations int
+	// releasedIP is the exit ip at the time of the last release, until the next observation
+	releasedIP       string
+	pendingRelease   bool
+	onFailedRotation func(proxyID string, exit Exit)
+}
+
+func newExitState() *exitState {
+	return &exitState{}
+}
+
+// EnableExitHistory keeps the last size observed exits of the proxy, DefaultExitHistorySize if size is 0
+//
+// onFailedRotation is called when the proxy keeps its exit ip after a release, it may be nil
+func (p *Proxy[C]) EnableExitHistory(size int, onFailedRotation func(proxyID string, exit Exit)) *Proxy[C] {
+	if p == nil || p.exit == nil {
+		return p
+	}
+	if size <= 0 {
+		size = DefaultExitHistorySize
+	}
+	p.exit.mu.Lock()
+	defer p.exit.mu.Unlock()
+	p.exit.history = make([]Exit, size)
+	p.exit.next, p.exit.full = 0, false
+	p.exit.onFailedRotation = onFailedRotation
+	return p
+}
+
+// SetObservedExit stores the exit observed through the proxy, and records it in the history if it's enabled
+//
+// It returns false if the proxy was released since the last observation but still exits from the same ip
+func (p *Proxy[C]) SetObservedExit(exit Exit) (rotated bool) {
+	if p == nil || p.exit == nil {
+		return true
+	}
+	if exit.ObservedAt.IsZero() {
+		exit.ObservedAt = time.Now()
+	}
+	p.exit.mu.Lock()
+	rotated = true
+	if p.exit.pendingRelease {
+		p.exit.pendingRelease = false
+		if p.exit.releasedIP != "" && p.exit.releasedIP == exit.IP {
+			rotated = false
+			p.exit.failedRotations++
+		}
+	}
+	p.exit.exit = &exit
+	if len(p.exit.history) > 0 {
+		p.exit.history[p.exit.next] = exit
+		p.exit.next = (p.exit.next + 1) % len(p.exit.history)
+		p.exit.full = p.exit.full || p.exit.next == 0
+	}
+	onFailedRotation := p.exit.onFailedRotation
+	p.exit.mu.Unlock()
+
+	if !rotated && onFailedRotation != nil {
+		onFailedRotation(p.ID(), exit)
+	}
+	return rotated
+}
+
+// markReleased records a release of the proxy, so the next observation can tell whether it rotated
+func (p *Proxy[C]) markReleased() {
+	if p == nil || p.exit == nil {
+		return
+	}
+	p.exit.mu.Lock()
+	defer p.exit.mu.Unlock()
+	p.exit.releases++
+	p.exit.pendingRelease = true
+	p.exit.releasedIP = ""
+	if p.exit.exit != nil {
+		p.exit.releasedIP = p.exit.exit.IP
+	}
+}
+
+// ExitHistory returns the exits in the history of the proxy, oldest first, nil if the history is disabled
+func (p *Proxy[C]) ExitHistory() []Exit {
+	if p == nil || p.exit == nil {
+		return nil
+	}
+	p.exit.mu.Lock()
+	defer p.exit.mu.Unlock()
+	return p.exit.historyLocked()
+}
+
+func (s *exitState) historyLocked() []Exit {
+	if !s.full {
+		return append([]Exit(nil), s.history[:s.next]...)
+	}
+	return append(append([]Exit(nil), s.history[s.next:]...), s.history[:s.next]...)
+}
+
+// RotationStats returns how well the proxy rotates its exit ip
+func (p *Proxy[C]) RotationStats() RotationStats {
+	if p == nil || p.exit == nil {
+		return RotationStats{}
+	}
+	p.exit.mu.Lock()
+	defer p.exit.mu.Unlock()
+	stats := RotationStats{Releases: p.exit.releases, FailedRotations: p.exit.failedRotations}
+	ips := map[string]struct{}{}
+	for _, exit := range p.exit.historyLocked() {
+		stats.Observations++
+		ips[exit.IP] = struct{}{}
+	}
+	stats.UniqueIPs = len(ips)
+	if stats.Observations > 0 {
+		stats.Diversity = float64(stats.UniqueIPs) / float64(stats.Observations)
+	}
+	return stats
+}
+
+// HasPoorDiversity reports whether the gateway, i.e., a rotating or released proxy, had less than minDiversity
+// unique ips per observation, once it has at least minObservations in its history
+func (p *Proxy[C]) HasPoorDiversity(minDiversity float64, minObservations int) bool {
+	if p == nil {
+		return false
+	}
+	stats := p.RotationStats()
+	if !p.Rotating && stats.Releases == 0 {
+		return false
+	}
+	return stats.Observations >= minObservations && stats.Diversity < minDiversity
+}
+
+// ObservedExit returns the last exit observed through the proxy, false if there is none
+func (p *Proxy[C]) ObservedExit() (Exit, bool) {
+	if p == nil || p.exit == nil {
+		return Exit{}, false
+	}
+	p.exit.mu.Lock()
+	defer p.exit.mu.Unlock()
+	if p.exit.exit == nil {
+		return Exit{}, false
+	}
+	return *p.exit.exit, true
+}
+
+// CountryFromUsername returns the country targeted by the username of a geo-targeting gateway, upper-cased,
+// e.g., IR for "customer-country-ir-session-1" or "user-cc-IR", empty if it targets none
+func CountryFromUsername(username string) string {
+	parts := strings.Split(username, "-")
+	for i := 0; i+1 < len(parts); i++ {
+		switch strings.ToLower(parts[i]) {
+		case "country", "cc":
+			if country := parts[i+1]; len(country) == 2 {
+				return strings.ToUpper(country)
+			}
+		}
+	}
+	return ""
+}
+
+// VerifyExitCountry returns ErrExitCountryMismatch if the observed exit is not in the Country the proxy claims
+//
+// It returns nil when the proxy doesn't claim a country, or the country of the exit is not known yet
+func (p *Proxy[C]) VerifyExitCountry() error {
+	exit, ok := p.ObservedExit()
+	if !ok || p.Country == "" || exit.Country == "" {
+		return nil
+	}
+	if !strings.EqualFold(p.Country, exit.Country) {
+		return errors.Wrapf(ErrExitCountryMismatch, "claims %s, exits from %s (%s)", p.Country, exit.Country, exit.IP)
+	}
+	return nil
+}
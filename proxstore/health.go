@@ -0,0 +1,101 @@
+package proxstore
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// healthWeight is the weight of the latest outcome in the health score
+const healthWeight = 0.3
+
+// ProxyFaulter is implemented by the errors that know whether the proxy caused the failure,
+// e.g., the request errors of the ve package
+type ProxyFaulter interface {
+	// ProxyFault reports whether the proxy is to blame for the failure
+	ProxyFault() bool
+}
+
+// Health is a snapshot of the health of a proxy
+type Health struct {
+	Successes           uint64
+	Failures            uint64
+	ConsecutiveFailures uint64
+	// Score is the moving average of the outcomes, from 0 (always failing) to 1 (always succeeding)
+	Score       float64
+	LastFailure time.Time
+	LastError   string
+}
+
+type health struct {
+	mu sync.Mutex
+	h  Health
+}
+
+func newHealth() *health {
+	return &health{h: Health{Score: 1}}
+}
+
+// ReportSuccess records a successful request through the proxy
+func (p *Proxy[C]) ReportSuccess() {
+	if p == nil || p.health == nil {
+		return
+	}
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	p.health.h.Successes++
+	p.health.h.ConsecutiveFailures = 0
+	p.health.h.Score = p.health.h.Score*(1-healthWeight) + healthWeight
+}
+
+// ReportFailure records a failed request through the proxy
+//
+// Errors implementing ProxyFaulter that aren't the proxy's fault, e.g., a 5xx from the target, are ignored
+func (p *Proxy[C]) ReportFailure(err error) {
+	if p == nil || p.health == nil || err == nil {
+		return
+	}
+	var faulter ProxyFaulter
+	if errors.As(err, &faulter) && !faulter.ProxyFault() {
+		return
+	}
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	p.health.h.Failures++
+	p.health.h.ConsecutiveFailures++
+	p.health.h.Score = p.health.h.Score * (1 - healthWeight)
+	p.health.h.LastFailure = time.Now()
+	p.health.h.LastError = err.Error()
+}
+
+// Health returns the health of the proxy, a proxy with no reports has the score of 1
+func (p *Proxy[C]) Health() Health {
+	if p == nil || p.health == nil {
+		return Health{Score: 1}
+	}
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	return p.health.h
+}
+
+// NextHealthy returns the next proxy with a health score of at least minScore,
+// the healthiest of them if there is none, nil if there are no proxies and Direct is not allowed, Direct otherwise.
+func (p *ProxStore[C]) NextHealthy(minScore float64) *Proxy[C] {
+	count := p.proxies.Len()
+	if count <= 1 {
+		return p.Next()
+	}
+	var best *Proxy[C]
+	bestScore := -1.0
+	for i := 0; i < count; i++ {
+		prox := p.Next()
+		score := prox.Health().Score
+		if score >= minScore {
+			return prox
+		}
+		if score > bestScore {
+			best, bestScore = prox, score
+		}
+	}
+	return best
+}
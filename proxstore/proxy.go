@@ -17,10 +17,13 @@ type Proxy[C any] struct {
 	Username          string
 	Password          string
 	Rotating          bool
+	Country           string // Country is the ISO 3166-1 alpha-2 code the proxy claims to exit from, optional
 	provider          *Provider
 	httpClient        *shardmap.Map[string, C]
 	httpClientCreator CreateHttpClientCreator[C]
 	reloadIp          *atomic.Bool
+	health            *health
+	exit              *exitState
 }
 
 // NewProxy creates a new proxy
@@ -30,10 +33,13 @@ func NewProxy[C any](host string, port uint16, protocol Protocol) *Proxy[C] {
 		Host:     host,
 		Port:     port,
 		reloadIp: &atomic.Bool{},
+		health:   newHealth(),
+		exit:     newExitState(),
 	}
 }
 
-// NewProxyWithCredential creates a new proxy with credential
+// NewProxyWithCredential creates a new proxy with credential,
+// it claims the country targeted by the username if any, see [CountryFromUsername]
 func NewProxyWithCredential[C any](
 	host string, port uint16, protocol Protocol, username string, password string,
 ) *Proxy[C] {
@@ -43,7 +49,10 @@ func NewProxyWithCredential[C any](
 		Port:     port,
 		Username: username,
 		Password: password,
+		Country:  CountryFromUsername(username),
 		reloadIp: &atomic.Bool{},
+		health:   newHealth(),
+		exit:     newExitState(),
 	}
 }
 
@@ -81,6 +90,22 @@ func (p *Proxy[C]) String() string {
 	return string(p.Protocol) + "://" + p.Username + ":" + p.Password + "@" + p.Host + ":" + p.PortString()
 }
 
+// ID returns the string representation of the proxy without the password, e.g., http://username@host:port
+//
+// It's safe to be logged and used to identify the proxy in the errors
+func (p *Proxy[C]) ID() string {
+	if p == nil {
+		return ""
+	}
+	if p.Protocol == ProtocolNone || p.Protocol == ProtocolDirect {
+		return p.String()
+	}
+	if p.Username == "" {
+		return string(p.Protocol) + "://" + p.Host + ":" + p.PortString()
+	}
+	return string(p.Protocol) + "://" + p.Username + "@" + p.Host + ":" + p.PortString()
+}
+
 // PortString returns the string representation of the port
 func (p *Proxy[C]) PortString() string {
 	return strconv.Itoa(int(p.Port))
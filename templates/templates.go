@@ -24,8 +24,9 @@ const (
 )
 
 const (
-	PageError Page = "error"
-	PageHome  Page = "home"
+	PageError  Page = "error"
+	PageHome   Page = "home"
+	PageQueues Page = "queues"
 )
 
 var UiNameMap UiNameMapType
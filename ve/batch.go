@@ -0,0 +1,175 @@
+package ve
+
+import (
+	"context"
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/conc/pool"
+	"net/url"
+	"sync"
+)
+
+type BatchOptions struct {
+	// MaxConcurrency is the maximum number of requests running at once, defaults to 10
+	MaxConcurrency int
+	// MaxPerHost is the maximum number of requests running at once to the same host, 0 means no limit
+	MaxPerHost int
+	// StopOnFatal cancels the remaining requests on the first fatal error
+	StopOnFatal bool
+	// IsFatal determines whether an error is fatal, defaults to every error being fatal
+	IsFatal func(err error) bool
+}
+
+// BatchResult is the outcome of a single requester of the batch
+type BatchResult[C any] struct {
+	Requester *Requester[C]
+	Response  *http.Response
+	Body      string
+	Err       error
+}
+
+// Batch runs many requesters concurrently, within a global and a per-host concurrency limit
+type Batch[C any] struct {
+	options    BatchOptions
+	requesters []*Requester[C]
+}
+
+// NewBatch creates a batch of the requesters
+func NewBatch[C any](options BatchOptions, requesters ...*Requester[C]) *Batch[C] {
+	if options.MaxConcurrency <= 0 {
+		options.MaxConcurrency = 10
+	}
+	if options.IsFatal == nil {
+		options.IsFatal = func(err error) bool { return true }
+	}
+	return &Batch[C]{
+		options:    options,
+		requesters: requesters,
+	}
+}
+
+// Add adds the requesters to the batch
+func (b *Batch[C]) Add(requesters ...*Requester[C]) *Batch[C] {
+	b.requesters = append(b.requesters, requesters...)
+	return b
+}
+
+// batchHost is the queue of the requests to a host, waiting for its slots
+type batchHost struct {
+	indexes []int
+	slots   chan struct{}
+}
+
+// Run runs all the requesters and returns their results in the order they were added
+//
+// The context of every requester is replaced with one derived from ctx, so cancelling ctx stops them all.
+// The returned error combines the errors of all the failed requests,
+// or is the first fatal error in case the batch was stopped because of it.
+func (b *Batch[C]) Run(ctx context.Context) ([]BatchResult[C], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		fatalErr  error
+		fatalOnce sync.Once
+	)
+	results := make([]BatchResult[C], len(b.requesters))
+	p := pool.New().WithContext(ctx).WithMaxGoroutines(b.options.MaxConcurrency)
+	submit := func(i int, release func()) {
+		p.Go(
+			func(ctx context.Context) error {
+				defer release()
+				result := &results[i]
+				if result.Err == nil {
+					result.Response, result.Body, result.Err = result.Requester.SetContext(ctx).Do()
+				}
+				err := result.Err
+				if err != nil && b.options.StopOnFatal && b.options.IsFatal(err) {
+					fatalOnce.Do(
+						func() {
+							fatalErr = err
+							cancel()
+						},
+					)
+				}
+				return err
+			},
+		)
+	}
+
+	hosts, order := map[string]*batchHost{}, []*batchHost(nil)
+	for i, r := range b.requesters {
+		results[i].Requester = r
+		host, err := b.host(r.GetLink())
+		if err != nil {
+			results[i].Err = err
+			submit(i, func() {})
+			continue
+		}
+		h, ok := hosts[host]
+		if !ok {
+			h = &batchHost{}
+			if b.options.MaxPerHost > 0 {
+				h.slots = make(chan struct{}, b.options.MaxPerHost)
+			}
+			hosts[host] = h
+			order = append(order, h)
+		}
+		h.indexes = append(h.indexes, i)
+	}
+
+	// Every host feeds its requests into the pool once it has a free slot, so a request waiting for its host
+	// never holds a goroutine of the pool while the requests to the other hosts could run
+	var feeders sync.WaitGroup
+	for _, h := range order {
+		feeders.Add(1)
+		go func() {
+			defer feeders.Done()
+			for n, i := range h.indexes {
+				release, err := h.acquire(ctx)
+				if err != nil {
+					for _, i := range h.indexes[n:] {
+						results[i].Err = errors.Wrap(err, "batch cancelled before the request started")
+					}
+					return
+				}
+				submit(i, release)
+			}
+		}()
+	}
+	feeders.Wait()
+
+	err := p.Wait()
+	if fatalErr != nil {
+		return results, errors.Wrap(fatalErr, "batch stopped on fatal error")
+	}
+	return results, err
+}
+
+// host returns the host of the link the per-host limit applies to, empty if there's no limit
+func (b *Batch[C]) host(link string) (string, error) {
+	if b.options.MaxPerHost <= 0 {
+		return "", nil
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse link")
+	}
+	return u.Host, nil
+}
+
+// acquire waits for a free slot of the host
+func (h *batchHost) acquire(ctx context.Context) (release func(), err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if h.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case h.slots <- struct{}{}:
+		return func() { <-h.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,116 @@
+package ve
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve/har"
+	"github.com/Dissociable/Couploan/ve/util"
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hostTracker is an interceptor answering every request after a delay, tracking the concurrency per host
+type hostTracker struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	max      map[string]int
+	started  []string
+	total    atomic.Int32
+	fail     string
+}
+
+func (h *hostTracker) intercept(req *http.Request, _ util.DoFunc) (*http.Response, error) {
+	h.mu.Lock()
+	h.inFlight[req.URL.Host]++
+	h.max[req.URL.Host] = max(h.max[req.URL.Host], h.inFlight[req.URL.Host])
+	h.started = append(h.started, req.URL.String())
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.inFlight[req.URL.Host]--
+		h.mu.Unlock()
+	}()
+	h.total.Add(1)
+
+	if req.URL.Path == h.fail {
+		return nil, errors.New("connection reset")
+	}
+	select {
+	case <-time.After(20 * time.Millisecond):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(req.URL.Path))}, nil
+}
+
+func newBatchRequesters(tracker *hostTracker, links ...string) []*Requester[any] {
+	proxy := proxstore.NewProxy[tls_client.HttpClient]("", 0, proxstore.ProtocolDirect)
+	client := har.NewClient(har.New(), har.MatchLenient)
+	requesters := make([]*Requester[any], len(links))
+	for i, link := range links {
+		requesters[i] = NewRequest[any](nil, "GET", link).
+			SetClient(client).
+			SetProxy(proxy).
+			AddInterceptor(tracker.intercept)
+	}
+	return requesters
+}
+
+func TestBatchLimits(t *testing.T) {
+	tracker := &hostTracker{inFlight: map[string]int{}, max: map[string]int{}}
+	var links []string
+	for i := 0; i < 6; i++ {
+		links = append(links, "https://a.test/"+string(rune('a'+i)), "https://b.test/"+string(rune('a'+i)))
+	}
+
+	results, err := NewBatch(BatchOptions{MaxConcurrency: 4, MaxPerHost: 2}, newBatchRequesters(tracker, links...)...).
+		Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, len(links))
+	for i, result := range results {
+		assert.NoError(t, result.Err)
+		assert.Equal(t, links[i], result.Requester.GetLink(), "results must keep the order of the requesters")
+		assert.Equal(t, links[i][len("https://a.test"):], result.Body)
+	}
+	assert.Equal(t, 2, tracker.max["a.test"])
+	assert.Equal(t, 2, tracker.max["b.test"])
+}
+
+func TestBatchStopOnFatal(t *testing.T) {
+	tracker := &hostTracker{inFlight: map[string]int{}, max: map[string]int{}, fail: "/fail"}
+	links := []string{"https://a.test/fail"}
+	for i := 0; i < 20; i++ {
+		links = append(links, "https://a.test/ok")
+	}
+
+	results, err := NewBatch(BatchOptions{MaxConcurrency: 1, StopOnFatal: true}, newBatchRequesters(tracker, links...)...).
+		Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection reset")
+	assert.Less(t, int(tracker.total.Load()), len(links), "the requests after the fatal error must not be sent")
+	assert.ErrorIs(t, results[len(results)-1].Err, context.Canceled)
+}
+
+func TestBatchHostDoesNotBlockOthers(t *testing.T) {
+	tracker := &hostTracker{inFlight: map[string]int{}, max: map[string]int{}}
+	links := []string{"https://a.test/a", "https://a.test/b", "https://a.test/c", "https://b.test/a"}
+
+	results, err := NewBatch(BatchOptions{MaxConcurrency: 2, MaxPerHost: 1}, newBatchRequesters(tracker, links...)...).
+		Run(context.Background())
+	require.NoError(t, err)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+	}
+	assert.Equal(t, 1, tracker.max["a.test"])
+	assert.Contains(t, tracker.started[:2], "https://b.test/a", "b.test must not wait behind the queue of a.test")
+}
@@ -0,0 +1,290 @@
+package ve
+
+import (
+	"context"
+	"fmt"
+	"github.com/phuslu/shardmap"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen matches a CircuitOpenError via errors.Is
+var ErrCircuitOpen = errors.New("circuit open")
+
+type CircuitState int
+
+const (
+	// CircuitClosed lets all the requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails all the requests fast until the cooldown is over
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through, to see whether the host recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitOpenError is returned by [Requester.Do] without sending the request when the circuit of its host is open
+type CircuitOpenError struct {
+	RequestError
+	Host string
+	// RetryIn is the remaining cooldown of the circuit
+	RetryIn time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit of %s is open (retry in %v): %s", e.Host, e.RetryIn, e.RequestError.Error())
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitBreakerStore shares the open circuits between the processes
+type CircuitBreakerStore interface {
+	// Open marks the circuit of the host as open until the given time
+	Open(ctx context.Context, host string, until time.Time) error
+	// OpenUntil returns until when the circuit of the host is open, the zero time if it's not
+	OpenUntil(ctx context.Context, host string) (time.Time, error)
+	// Close marks the circuit of the host as closed
+	Close(ctx context.Context, host string) error
+}
+
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit, defaults to 5
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before letting the probes through, defaults to 30 seconds
+	Cooldown time.Duration
+	// HalfOpenRequests is the number of probe requests let through in the half-open state, defaults to 1
+	HalfOpenRequests int
+	// IsFailure determines whether the error of a request counts as a failure of its host,
+	// defaults to every error except the proxy errors and the cancellations
+	IsFailure func(err error) bool
+	// Store shares the open circuits between the processes, optional
+	Store CircuitBreakerStore
+	// StoreCacheTTL is how long the state read from the store is reused before reading it again,
+	// defaults to a tenth of the cooldown
+	StoreCacheTTL time.Duration
+}
+
+// CircuitBreaker fails the requests to the hosts that keep failing fast,
+// instead of letting every caller retry into them
+type CircuitBreaker struct {
+	options  CircuitBreakerOptions
+	circuits *shardmap.Map[string, *circuit]
+	mu       sync.Mutex
+}
+
+type circuit struct {
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	probes    int
+	openUntil time.Time
+	// checkedAt is when the store was last read
+	checkedAt time.Time
+}
+
+// NewCircuitBreaker creates a circuit breaker, every host has its own circuit
+func NewCircuitBreaker(options CircuitBreakerOptions) *CircuitBreaker {
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = 5
+	}
+	if options.Cooldown <= 0 {
+		options.Cooldown = 30 * time.Second
+	}
+	if options.StoreCacheTTL <= 0 {
+		options.StoreCacheTTL = options.Cooldown / 10
+	}
+	if options.HalfOpenRequests <= 0 {
+		options.HalfOpenRequests = 1
+	}
+	if options.IsFailure == nil {
+		options.IsFailure = func(err error) bool {
+			return !errors.Is(err, ErrProxy) && !errors.Is(err, context.Canceled)
+		}
+	}
+	return &CircuitBreaker{
+		options:  options,
+		circuits: shardmap.New[string, *circuit](0),
+	}
+}
+
+func (b *CircuitBreaker) circuit(host string) *circuit {
+	if c, ok := b.circuits.Get(host); ok {
+		return c
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits.Get(host)
+	if !ok {
+		c = &circuit{}
+		b.circuits.Set(host, c)
+	}
+	return c
+}
+
+// Allow reports whether a request to the host may be sent, returning how long to wait otherwise
+//
+// A failure of the store lets the request through, so the store being down never blocks the requests
+func (b *CircuitBreaker) Allow(ctx context.Context, host string) (allowed bool, retryIn time.Duration) {
+	c := b.circuit(host)
+	b.readStore(ctx, host, c)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	switch c.state {
+	case CircuitOpen:
+		if now.Before(c.openUntil) {
+			return false, c.openUntil.Sub(now)
+		}
+		c.state, c.probes = CircuitHalfOpen, 0
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probes >= b.options.HalfOpenRequests {
+			return false, b.options.Cooldown
+		}
+		c.probes++
+	}
+	return true, 0
+}
+
+// readStore opens the closed circuit if it's open in the store, the store is read outside the lock of the circuit
+// and at most once per StoreCacheTTL
+func (b *CircuitBreaker) readStore(ctx context.Context, host string, c *circuit) {
+	if b.options.Store == nil {
+		return
+	}
+	c.mu.Lock()
+	now := time.Now()
+	if c.state != CircuitClosed || now.Sub(c.checkedAt) < b.options.StoreCacheTTL {
+		c.mu.Unlock()
+		return
+	}
+	// The other callers keep using the local state meanwhile, rather than reading the store too
+	c.checkedAt = now
+	c.mu.Unlock()
+
+	until, err := b.options.Store.OpenUntil(ctx, host)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == CircuitClosed && until.After(time.Now()) {
+		c.state, c.openUntil = CircuitOpen, until
+	}
+}
+
+// Report records the outcome of a request to the host, err being nil on success,
+// the errors that aren't failures of the host leave its circuit as it is
+func (b *CircuitBreaker) Report(ctx context.Context, host string, err error) {
+	c := b.circuit(host)
+	c.mu.Lock()
+	if err != nil && !b.options.IsFailure(err) {
+		// The request tells nothing about the host, e.g., it died at the proxy or was cancelled,
+		// so a probe gives its slot back to another one
+		if c.state == CircuitHalfOpen && c.probes > 0 {
+			c.probes--
+		}
+		c.mu.Unlock()
+		return
+	}
+	if err == nil {
+		recovered := c.state == CircuitHalfOpen
+		c.state, c.failures = CircuitClosed, 0
+		c.mu.Unlock()
+		if recovered && b.options.Store != nil {
+			_ = b.options.Store.Close(ctx, host)
+		}
+		return
+	}
+	c.failures++
+	if c.state != CircuitHalfOpen && c.failures < b.options.FailureThreshold {
+		c.mu.Unlock()
+		return
+	}
+	c.state, c.failures = CircuitOpen, 0
+	c.openUntil = time.Now().Add(b.options.Cooldown)
+	openUntil := c.openUntil
+	c.mu.Unlock()
+	if b.options.Store != nil {
+		_ = b.options.Store.Open(ctx, host, openUntil)
+	}
+}
+
+// State returns the state of the circuit of the host in this process
+func (b *CircuitBreaker) State(host string) CircuitState {
+	c := b.circuit(host)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == CircuitOpen && !time.Now().Before(c.openUntil) {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// RedisCircuitBreakerStore stores the open circuits as keys expiring with their cooldown in Redis
+type RedisCircuitBreakerStore struct {
+	Client *redis.Client
+	// Prefix is prepended to the hosts to build the keys
+	Prefix string
+}
+
+// NewRedisCircuitBreakerStore creates a redis store, the keys are prefixed by "circuit::"
+func NewRedisCircuitBreakerStore(client *redis.Client) *RedisCircuitBreakerStore {
+	return &RedisCircuitBreakerStore{
+		Client: client,
+		Prefix: "circuit::",
+	}
+}
+
+func (s *RedisCircuitBreakerStore) Open(ctx context.Context, host string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.Client.Set(ctx, s.Prefix+host, until.UnixMilli(), ttl).Err(); err != nil {
+		return errors.Wrap(err, "failed to open circuit in redis")
+	}
+	return nil
+}
+
+func (s *RedisCircuitBreakerStore) OpenUntil(ctx context.Context, host string) (time.Time, error) {
+	value, err := s.Client.Get(ctx, s.Prefix+host).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, errors.Wrap(err, "failed to get circuit from redis")
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "invalid circuit value in redis")
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (s *RedisCircuitBreakerStore) Close(ctx context.Context, host string) error {
+	if err := s.Client.Del(ctx, s.Prefix+host).Err(); err != nil {
+		return errors.Wrap(err, "failed to close circuit in redis")
+	}
+	return nil
+}
+
+// Ensure interface compatibility
+var _ CircuitBreakerStore = (*RedisCircuitBreakerStore)(nil)
@@ -0,0 +1,161 @@
+package ve
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve/har"
+	"github.com/Dissociable/Couploan/ve/util"
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCircuitStore is a CircuitBreakerStore kept in memory, standing in for redis
+type memoryCircuitStore struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func (s *memoryCircuitStore) Open(_ context.Context, host string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.until[host] = until
+	return nil
+}
+
+func (s *memoryCircuitStore) OpenUntil(_ context.Context, host string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.until[host], nil
+}
+
+func (s *memoryCircuitStore) Close(_ context.Context, host string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.until, host)
+	return nil
+}
+
+func TestRequesterCircuitBreaker(t *testing.T) {
+	status, sent := 503, 0
+	respond := func(req *http.Request, _ util.DoFunc) (*http.Response, error) {
+		sent++
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	cb := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 2, Cooldown: 50 * time.Millisecond})
+	proxy := proxstore.NewProxy[tls_client.HttpClient]("", 0, proxstore.ProtocolDirect)
+	do := func() error {
+		_, _, err := NewRequest[any](nil, "GET", "https://shapesolver.test/api/v1/f5").
+			SetClient(har.NewClient(har.New(), har.MatchLenient)).
+			SetProxy(proxy).
+			SetCircuitBreaker(cb).
+			SetRetry().
+			SetMaxRetries(5).
+			AddInterceptor(respond).
+			Do()
+		return err
+	}
+
+	err := do()
+	var openErr *CircuitOpenError
+	require.ErrorAs(t, err, &openErr, "retries must stop once the circuit opens")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, "shapesolver.test", openErr.Host)
+	assert.Equal(t, 3, openErr.Attempt)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, CircuitOpen, cb.State("shapesolver.test"))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, cb.State("shapesolver.test"))
+	status = 200
+	require.NoError(t, do())
+	assert.Equal(t, 3, sent)
+	assert.Equal(t, CircuitClosed, cb.State("shapesolver.test"))
+}
+
+func TestCircuitBreakerSharedStore(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryCircuitStore{until: map[string]time.Time{}}
+	first := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1, Cooldown: time.Minute, Store: store})
+	second := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1, Cooldown: time.Minute, Store: store})
+
+	first.Report(ctx, "ve.cbi.ir", &StatusError{StatusCode: 502})
+	allowed, retryIn := second.Allow(ctx, "ve.cbi.ir")
+	assert.False(t, allowed, "the circuit opened by another process must be honored")
+	assert.Greater(t, retryIn, 50*time.Second)
+
+	// proxy errors are not the fault of the host
+	second.Report(ctx, "api.ipify.org", &ProxyError{})
+	allowed, _ = second.Allow(ctx, "api.ipify.org")
+	assert.True(t, allowed)
+}
+
+// slowCircuitStore counts the reads of the circuits, blocking them until release is closed
+type slowCircuitStore struct {
+	memoryCircuitStore
+	reads   atomic.Int32
+	release chan struct{}
+}
+
+func (s *slowCircuitStore) OpenUntil(ctx context.Context, host string) (time.Time, error) {
+	s.reads.Add(1)
+	<-s.release
+	return s.memoryCircuitStore.OpenUntil(ctx, host)
+}
+
+func TestCircuitBreakerStoreRead(t *testing.T) {
+	ctx := context.Background()
+	store := &slowCircuitStore{memoryCircuitStore: memoryCircuitStore{until: map[string]time.Time{}}, release: make(chan struct{})}
+	cb := NewCircuitBreaker(CircuitBreakerOptions{Cooldown: time.Minute, Store: store})
+
+	done := make(chan bool)
+	go func() {
+		allowed, _ := cb.Allow(ctx, "ve.cbi.ir")
+		done <- allowed
+	}()
+	require.Eventually(t, func() bool { return store.reads.Load() == 1 }, time.Second, time.Millisecond)
+	// the circuit isn't locked while the store is read, the other callers use the local state
+	assert.Equal(t, CircuitClosed, cb.State("ve.cbi.ir"))
+	allowed, _ := cb.Allow(ctx, "ve.cbi.ir")
+	assert.True(t, allowed)
+	close(store.release)
+	assert.True(t, <-done)
+
+	require.NoError(t, store.Open(ctx, "ve.cbi.ir", time.Now().Add(time.Minute)))
+	allowed, _ = cb.Allow(ctx, "ve.cbi.ir")
+	assert.True(t, allowed, "the state read from the store is reused for StoreCacheTTL")
+	assert.EqualValues(t, 1, store.reads.Load())
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	ctx := context.Background()
+	cb := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1, Cooldown: 10 * time.Millisecond})
+	cb.Report(ctx, "ve.cbi.ir", &StatusError{StatusCode: 502})
+	time.Sleep(15 * time.Millisecond)
+
+	allowed, _ := cb.Allow(ctx, "ve.cbi.ir")
+	require.True(t, allowed)
+	allowed, _ = cb.Allow(ctx, "ve.cbi.ir")
+	assert.False(t, allowed, "only one probe is let through")
+
+	// a probe dying at the proxy or cancelled doesn't close the circuit, but gives its slot back
+	cb.Report(ctx, "ve.cbi.ir", &ProxyError{})
+	assert.Equal(t, CircuitHalfOpen, cb.State("ve.cbi.ir"))
+	allowed, _ = cb.Allow(ctx, "ve.cbi.ir")
+	require.True(t, allowed)
+	cb.Report(ctx, "ve.cbi.ir", context.Canceled)
+	assert.Equal(t, CircuitHalfOpen, cb.State("ve.cbi.ir"))
+
+	allowed, _ = cb.Allow(ctx, "ve.cbi.ir")
+	require.True(t, allowed)
+	cb.Report(ctx, "ve.cbi.ir", nil)
+	assert.Equal(t, CircuitClosed, cb.State("ve.cbi.ir"))
+}
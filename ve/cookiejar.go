@@ -1,11 +1,19 @@
 package ve
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
 	cookiejar "github.com/Dissociable/persistent-cookiejar"
 	http "github.com/bogdanfinn/fhttp"
+	"github.com/goccy/go-json"
 	"github.com/pkg/errors"
+	"io"
 	http2 "net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type CookieJarOptions struct {
@@ -14,6 +22,19 @@ type CookieJarOptions struct {
 
 type CookieJar struct {
 	Jar *cookiejar.Jar
+	// SessionID is the id of the session the jar belongs to, empty if it's not managed by [CookieJarSessions]
+	SessionID string
+}
+
+// jsonCookie is the JSON export format of a cookie
+type jsonCookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Domain   string     `json:"domain"`
+	Path     string     `json:"path"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Secure   bool       `json:"secure"`
+	HttpOnly bool       `json:"httpOnly"`
 }
 
 func NewCookieJar(options *CookieJarOptions) (*CookieJar, error) {
@@ -77,5 +98,171 @@ func (c CookieJar) Cookies(u *url.URL) []*http.Cookie {
 	return transformed
 }
 
+// AllCookies returns all the unexpired cookies in the jar, session cookies have a zero Expires
+func (c CookieJar) AllCookies() []*http.Cookie {
+	var cookies []*http.Cookie
+	for _, cookie := range c.Jar.AllCookies() {
+		expires := cookie.Expires
+		// The jar expires session cookies at the end of time
+		if expires.Year() >= 9999 {
+			expires = time.Time{}
+		}
+		cookies = append(
+			cookies, &http.Cookie{
+				Name:     cookie.Name,
+				Value:    cookie.Value,
+				Path:     cookie.Path,
+				Domain:   cookie.Domain,
+				Expires:  expires,
+				Secure:   cookie.Secure,
+				HttpOnly: cookie.HttpOnly,
+			},
+		)
+	}
+	return cookies
+}
+
+// ImportCookies sets the cookies to the jar, each cookie must have its Domain set
+func (c CookieJar) ImportCookies(cookies []*http.Cookie) {
+	for _, cookie := range cookies {
+		domain := strings.TrimPrefix(cookie.Domain, ".")
+		if domain == "" {
+			continue
+		}
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		path := cookie.Path
+		if path == "" {
+			path = "/"
+		}
+		c.SetCookies(&url.URL{Scheme: scheme, Host: domain, Path: path}, []*http.Cookie{cookie})
+	}
+}
+
+// ExportJSON exports all the cookies of the jar, including session cookies, as a JSON array
+func (c CookieJar) ExportJSON() ([]byte, error) {
+	cookies := make([]jsonCookie, 0)
+	for _, cookie := range c.AllCookies() {
+		jc := jsonCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		}
+		if !cookie.Expires.IsZero() {
+			expires := cookie.Expires
+			jc.Expires = &expires
+		}
+		cookies = append(cookies, jc)
+	}
+	data, err := json.Marshal(cookies)
+	if err != nil {
+		err = errors.Wrap(err, "failed to marshal cookies")
+		return nil, err
+	}
+	return data, nil
+}
+
+// ImportJSON imports the cookies exported by [CookieJar.ExportJSON]
+func (c CookieJar) ImportJSON(data []byte) error {
+	var jcs []jsonCookie
+	if err := json.Unmarshal(data, &jcs); err != nil {
+		return errors.Wrap(err, "failed to unmarshal cookies")
+	}
+	cookies := make([]*http.Cookie, 0, len(jcs))
+	for _, jc := range jcs {
+		cookie := &http.Cookie{
+			Name:     jc.Name,
+			Value:    jc.Value,
+			Domain:   jc.Domain,
+			Path:     jc.Path,
+			Secure:   jc.Secure,
+			HttpOnly: jc.HttpOnly,
+		}
+		if jc.Expires != nil {
+			cookie.Expires = *jc.Expires
+		}
+		cookies = append(cookies, cookie)
+	}
+	c.ImportCookies(cookies)
+	return nil
+}
+
+// ExportNetscape exports all the cookies of the jar in the Netscape cookies.txt format
+func (c CookieJar) ExportNetscape() []byte {
+	var b bytes.Buffer
+	b.WriteString("# Netscape HTTP Cookie File\n")
+	for _, cookie := range c.AllCookies() {
+		domain := cookie.Domain
+		if cookie.HttpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		var expires int64
+		if !cookie.Expires.IsZero() {
+			expires = cookie.Expires.Unix()
+		}
+		_, _ = fmt.Fprintf(
+			&b, "%s\tTRUE\t%s\t%s\t%d\t%s\t%s\n",
+			domain, cookie.Path, netscapeBool(cookie.Secure), expires, cookie.Name, cookie.Value,
+		)
+	}
+	return b.Bytes()
+}
+
+// ImportNetscape imports the cookies from a Netscape cookies.txt file
+func (c CookieJar) ImportNetscape(r io.Reader) error {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		httpOnly := false
+		if strings.HasPrefix(text, "#HttpOnly_") {
+			httpOnly = true
+			text = strings.TrimPrefix(text, "#HttpOnly_")
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return errors.Errorf("invalid netscape cookie at line %d", line)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid netscape cookie expiry at line %d", line)
+		}
+		cookie := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, cookie)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read netscape cookies")
+	}
+	c.ImportCookies(cookies)
+	return nil
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
 // Ensure interface compatibility
 var _ http.CookieJar = (*CookieJar)(nil)
@@ -0,0 +1,209 @@
+package ve
+
+import (
+	"context"
+	"github.com/phuslu/shardmap"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CookieJarSessionsOptions struct {
+	// Store persists the jars, required
+	Store CookieJarStore
+	// TTL is how long a jar is kept after its last use, defaults to 24 hours
+	TTL time.Duration
+	// CleanupInterval is the interval of saving and evicting the idle jars, defaults to 5 minutes
+	CleanupInterval time.Duration
+	// Logger logs the failures of the background cleanup, defaults to a no-op logger
+	Logger *zap.Logger
+}
+
+// CookieJarSessions keeps the cookie jars by session id, so they survive worker restarts
+//
+// The jars are loaded from the store on first use and saved back via [CookieJarSessions.Save],
+// a background cleanup saves and evicts the jars idle for longer than the TTL until Close is called.
+type CookieJarSessions struct {
+	options CookieJarSessionsOptions
+	jars    *shardmap.Map[string, *cookieJarSession]
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+type cookieJarSession struct {
+	jar      *CookieJar
+	lastUsed atomic.Int64
+}
+
+// NewCookieJarSessions creates the sessions and starts their background cleanup
+func NewCookieJarSessions(options CookieJarSessionsOptions) (*CookieJarSessions, error) {
+	if options.Store == nil {
+		return nil, errors.New("cookie jar sessions require a store")
+	}
+	if options.TTL <= 0 {
+		options.TTL = 24 * time.Hour
+	}
+	if options.CleanupInterval <= 0 {
+		options.CleanupInterval = 5 * time.Minute
+	}
+	if options.Logger == nil {
+		options.Logger = zap.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &CookieJarSessions{
+		options: options,
+		jars:    shardmap.New[string, *cookieJarSession](0),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go s.cleanupLoop(ctx)
+	return s, nil
+}
+
+// Get returns the jar of the session, loading it from the store or creating an empty one
+func (s *CookieJarSessions) Get(ctx context.Context, sessionID string) (*CookieJar, error) {
+	if sess, ok := s.jars.Get(sessionID); ok {
+		sess.lastUsed.Store(time.Now().UnixNano())
+		return sess.jar, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Another caller may have loaded it meanwhile
+	if sess, ok := s.jars.Get(sessionID); ok {
+		sess.lastUsed.Store(time.Now().UnixNano())
+		return sess.jar, nil
+	}
+
+	jar, err := NewCookieJar(&CookieJarOptions{Options: nil})
+	if err != nil {
+		return nil, err
+	}
+	jar.SessionID = sessionID
+	data, err := s.options.Store.Load(ctx, sessionID)
+	switch {
+	case errors.Is(err, ErrCookieJarNotFound):
+	case err != nil:
+		return nil, errors.Wrapf(err, "failed to load cookie jar of session %s", sessionID)
+	default:
+		if err = jar.ImportJSON(data); err != nil {
+			return nil, errors.Wrapf(err, "failed to import cookie jar of session %s", sessionID)
+		}
+	}
+
+	sess := &cookieJarSession{jar: jar}
+	sess.lastUsed.Store(time.Now().UnixNano())
+	s.jars.Set(sessionID, sess)
+	return jar, nil
+}
+
+// Save saves the jar of the session to the store, extending its TTL
+func (s *CookieJarSessions) Save(ctx context.Context, sessionID string) error {
+	sess, ok := s.jars.Get(sessionID)
+	if !ok {
+		return nil
+	}
+	return s.save(ctx, sessionID, sess)
+}
+
+func (s *CookieJarSessions) save(ctx context.Context, sessionID string, sess *cookieJarSession) error {
+	data, err := sess.jar.ExportJSON()
+	if err != nil {
+		return err
+	}
+	if err = s.options.Store.Save(ctx, sessionID, data, s.options.TTL); err != nil {
+		return errors.Wrapf(err, "failed to save cookie jar of session %s", sessionID)
+	}
+	return nil
+}
+
+// SaveAll saves all the loaded jars to the store
+func (s *CookieJarSessions) SaveAll(ctx context.Context) error {
+	var errs []error
+	s.jars.Range(
+		func(sessionID string, sess *cookieJarSession) bool {
+			if err := s.save(ctx, sessionID, sess); err != nil {
+				errs = append(errs, err)
+			}
+			return true
+		},
+	)
+	if len(errs) > 0 {
+		return errors.Wrapf(errs[0], "failed to save %d cookie jars", len(errs))
+	}
+	return nil
+}
+
+// Delete removes the jar of the session from memory and the store
+func (s *CookieJarSessions) Delete(ctx context.Context, sessionID string) error {
+	s.jars.Delete(sessionID)
+	return s.options.Store.Delete(ctx, sessionID)
+}
+
+// Len returns the number of jars loaded in memory
+func (s *CookieJarSessions) Len() int {
+	return s.jars.Len()
+}
+
+// Cleanup saves and evicts the jars idle for longer than the TTL, and cleans the store up if it supports it
+//
+// A jar is only evicted once it's saved, a jar which couldn't be saved is kept and retried on the next cleanup.
+func (s *CookieJarSessions) Cleanup(ctx context.Context) error {
+	threshold := time.Now().Add(-s.options.TTL).UnixNano()
+	idle := map[string]*cookieJarSession{}
+	s.jars.Range(
+		func(sessionID string, sess *cookieJarSession) bool {
+			if sess.lastUsed.Load() < threshold {
+				idle[sessionID] = sess
+			}
+			return true
+		},
+	)
+	var errs []error
+	for sessionID, sess := range idle {
+		if err := s.save(ctx, sessionID, sess); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// It may have been used while being saved
+		if sess.lastUsed.Load() < threshold {
+			s.jars.Delete(sessionID)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Wrapf(errs[0], "failed to save %d idle cookie jars", len(errs))
+	}
+	if cleaner, ok := s.options.Store.(CookieJarStoreCleaner); ok {
+		return cleaner.Cleanup(ctx)
+	}
+	return nil
+}
+
+func (s *CookieJarSessions) cleanupLoop(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.options.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SaveAll(ctx); err != nil {
+				s.options.Logger.Warn("failed to save cookie jars", zap.Error(err))
+			}
+			if err := s.Cleanup(ctx); err != nil {
+				s.options.Logger.Warn("failed to clean cookie jars up", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Close stops the background cleanup and saves all the loaded jars
+func (s *CookieJarSessions) Close(ctx context.Context) error {
+	s.cancel()
+	<-s.done
+	return s.SaveAll(ctx)
+}
@@ -0,0 +1,169 @@
+package ve
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrCookieJarNotFound = errors.New("cookie jar not found")
+
+// CookieJarStore persists the exported cookies of the jars by their session id
+type CookieJarStore interface {
+	// Save stores the data of the session, it expires after ttl
+	Save(ctx context.Context, sessionID string, data []byte, ttl time.Duration) error
+	// Load returns the data of the session, ErrCookieJarNotFound if there is none or it's expired
+	Load(ctx context.Context, sessionID string) ([]byte, error)
+	// Delete removes the data of the session
+	Delete(ctx context.Context, sessionID string) error
+}
+
+// CookieJarStoreCleaner is implemented by the stores that don't expire the sessions by themselves
+type CookieJarStoreCleaner interface {
+	// Cleanup removes the expired sessions
+	Cleanup(ctx context.Context) error
+}
+
+// FileCookieJarStore stores each session as a JSON file in Dir
+type FileCookieJarStore struct {
+	Dir string
+}
+
+// NewFileCookieJarStore creates the directory if it does not exist and returns a file store over it
+func NewFileCookieJarStore(dir string) (*FileCookieJarStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		err = errors.Wrap(err, "failed to create cookie jar directory")
+		return nil, err
+	}
+	return &FileCookieJarStore{Dir: dir}, nil
+}
+
+// path returns the file of the session, named by the hash of the whole id, as the ids may hold any character,
+// e.g., the slashes and colons of a proxy id
+func (s *FileCookieJarStore) path(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *FileCookieJarStore) Save(_ context.Context, sessionID string, data []byte, ttl time.Duration) error {
+	p := s.path(sessionID)
+	// Write to a temporary file first, so a crash never leaves a half written jar behind
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write cookie jar file")
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return errors.Wrap(err, "failed to replace cookie jar file")
+	}
+	// The modification time holds the expiry of the session
+	expiresAt := time.Now().Add(ttl)
+	if err := os.Chtimes(p, expiresAt, expiresAt); err != nil {
+		return errors.Wrap(err, "failed to set cookie jar expiry")
+	}
+	return nil
+}
+
+func (s *FileCookieJarStore) Load(_ context.Context, sessionID string) ([]byte, error) {
+	p := s.path(sessionID)
+	info, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrCookieJarNotFound
+		}
+		return nil, errors.Wrap(err, "failed to stat cookie jar file")
+	}
+	if info.ModTime().Before(time.Now()) {
+		_ = os.Remove(p)
+		return nil, ErrCookieJarNotFound
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cookie jar file")
+	}
+	return data, nil
+}
+
+func (s *FileCookieJarStore) Delete(_ context.Context, sessionID string) error {
+	if err := os.Remove(s.path(sessionID)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to delete cookie jar file")
+	}
+	return nil
+}
+
+// Cleanup removes the files of the expired sessions
+func (s *FileCookieJarStore) Cleanup(ctx context.Context) error {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to read cookie jar directory")
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(now) {
+			_ = os.Remove(filepath.Join(s.Dir, e.Name()))
+		}
+	}
+	return nil
+}
+
+// RedisCookieJarStore stores each session as a key with an expiration in Redis
+type RedisCookieJarStore struct {
+	Client *redis.Client
+	// Prefix is prepended to the session ids to build the keys
+	Prefix string
+}
+
+// NewRedisCookieJarStore creates a redis store, the keys are prefixed by "cookiejar::"
+func NewRedisCookieJarStore(client *redis.Client) *RedisCookieJarStore {
+	return &RedisCookieJarStore{
+		Client: client,
+		Prefix: "cookiejar::",
+	}
+}
+
+func (s *RedisCookieJarStore) Save(ctx context.Context, sessionID string, data []byte, ttl time.Duration) error {
+	if err := s.Client.Set(ctx, s.Prefix+sessionID, data, ttl).Err(); err != nil {
+		return errors.Wrap(err, "failed to save cookie jar to redis")
+	}
+	return nil
+}
+
+func (s *RedisCookieJarStore) Load(ctx context.Context, sessionID string) ([]byte, error) {
+	data, err := s.Client.Get(ctx, s.Prefix+sessionID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrCookieJarNotFound
+		}
+		return nil, errors.Wrap(err, "failed to load cookie jar from redis")
+	}
+	return data, nil
+}
+
+func (s *RedisCookieJarStore) Delete(ctx context.Context, sessionID string) error {
+	if err := s.Client.Del(ctx, s.Prefix+sessionID).Err(); err != nil {
+		return errors.Wrap(err, "failed to delete cookie jar from redis")
+	}
+	return nil
+}
+
+// Ensure interface compatibility
+var (
+	_ CookieJarStore        = (*FileCookieJarStore)(nil)
+	_ CookieJarStoreCleaner = (*FileCookieJarStore)(nil)
+	_ CookieJarStore        = (*RedisCookieJarStore)(nil)
+)
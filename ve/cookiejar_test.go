@@ -0,0 +1,170 @@
+package ve
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var veURL = &url.URL{Scheme: "https", Host: "ve.cbi.ir", Path: "/"}
+
+func newTestCookieJar(t *testing.T) *CookieJar {
+	cj, err := NewCookieJar(&CookieJarOptions{Options: nil})
+	require.NoError(t, err)
+	return cj
+}
+
+func cookieValues(cj *CookieJar) map[string]string {
+	values := map[string]string{}
+	for _, c := range cj.Cookies(veURL) {
+		values[c.Name] = c.Value
+	}
+	return values
+}
+
+func TestCookieJarExportImport(t *testing.T) {
+	cj := newTestCookieJar(t)
+	cj.SetCookies(
+		veURL, []*http.Cookie{
+			{Name: "ASP.NET_SessionId", Value: "session", HttpOnly: true},
+			{Name: "TSPD", Value: "persistent", Expires: time.Now().Add(time.Hour)},
+		},
+	)
+	want := map[string]string{"ASP.NET_SessionId": "session", "TSPD": "persistent"}
+
+	data, err := cj.ExportJSON()
+	require.NoError(t, err)
+	fromJSON := newTestCookieJar(t)
+	require.NoError(t, fromJSON.ImportJSON(data))
+	assert.Equal(t, want, cookieValues(fromJSON))
+
+	netscape := cj.ExportNetscape()
+	assert.Contains(t, string(netscape), "#HttpOnly_ve.cbi.ir\tTRUE\t/\tFALSE\t0\tASP.NET_SessionId\tsession")
+	fromNetscape := newTestCookieJar(t)
+	require.NoError(t, fromNetscape.ImportNetscape(bytes.NewReader(netscape)))
+	assert.Equal(t, want, cookieValues(fromNetscape))
+
+	assert.Error(t, newTestCookieJar(t).ImportNetscape(strings.NewReader("ve.cbi.ir\tTRUE\t/")))
+}
+
+func TestCookieJarSessionsSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileCookieJarStore(t.TempDir())
+	require.NoError(t, err)
+
+	sessions, err := NewCookieJarSessions(CookieJarSessionsOptions{Store: store})
+	require.NoError(t, err)
+	cj, err := sessions.Get(ctx, "session-1")
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", cj.SessionID)
+	cj.SetCookies(veURL, []*http.Cookie{{Name: "ASP.NET_SessionId", Value: "session"}})
+	require.NoError(t, sessions.Close(ctx))
+
+	restarted, err := NewCookieJarSessions(CookieJarSessionsOptions{Store: store})
+	require.NoError(t, err)
+	defer restarted.Close(ctx)
+	cj, err = restarted.Get(ctx, "session-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ASP.NET_SessionId": "session"}, cookieValues(cj))
+
+	require.NoError(t, restarted.Delete(ctx, "session-1"))
+	_, err = store.Load(ctx, "session-1")
+	assert.ErrorIs(t, err, ErrCookieJarNotFound)
+}
+
+func TestFileCookieJarStoreExpires(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileCookieJarStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Save(ctx, "expired", []byte("[]"), -time.Second))
+	require.NoError(t, store.Save(ctx, "alive", []byte("[]"), time.Hour))
+	require.NoError(t, store.Cleanup(ctx))
+
+	_, err = store.Load(ctx, "expired")
+	assert.ErrorIs(t, err, ErrCookieJarNotFound)
+	_, err = store.Load(ctx, "alive")
+	assert.NoError(t, err)
+}
+
+func TestFileCookieJarStoreSessionIDs(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileCookieJarStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Save(ctx, "pool:http://user@127.0.0.1:8080", []byte("http"), time.Hour))
+	require.NoError(t, store.Save(ctx, "pool:socks5://user@127.0.0.1:8080", []byte("socks5"), time.Hour))
+	data, err := store.Load(ctx, "pool:http://user@127.0.0.1:8080")
+	require.NoError(t, err)
+	assert.Equal(t, "http", string(data), "the ids sharing their last path element must not share a file")
+	assert.NotContains(t, filepath.Base(store.path("pool:http://user@127.0.0.1:8080")), ":")
+}
+
+// flakyCookieJarStore records the saved sessions and fails the saves while fail is set
+type flakyCookieJarStore struct {
+	CookieJarStore
+	fail  bool
+	saved []string
+}
+
+func (s *flakyCookieJarStore) Save(ctx context.Context, sessionID string, data []byte, ttl time.Duration) error {
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.saved = append(s.saved, sessionID)
+	return nil
+}
+
+func TestCookieJarSessionsCleanupSavesBeforeEvicting(t *testing.T) {
+	ctx := context.Background()
+	fileStore, err := NewFileCookieJarStore(t.TempDir())
+	require.NoError(t, err)
+	store := &flakyCookieJarStore{CookieJarStore: fileStore, fail: true}
+	sessions, err := NewCookieJarSessions(
+		CookieJarSessionsOptions{Store: store, TTL: time.Nanosecond, CleanupInterval: time.Hour},
+	)
+	require.NoError(t, err)
+	_, err = sessions.Get(ctx, "session-1")
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+
+	assert.Error(t, sessions.Cleanup(ctx))
+	assert.Equal(t, 1, sessions.Len(), "a jar which couldn't be saved is kept")
+
+	store.fail = false
+	require.NoError(t, sessions.Cleanup(ctx))
+	assert.Equal(t, 0, sessions.Len())
+	assert.Equal(t, []string{"session-1"}, store.saved)
+	require.NoError(t, sessions.Close(ctx))
+}
+
+func TestVE_SetSessionID(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileCookieJarStore(t.TempDir())
+	require.NoError(t, err)
+	sessions, err := NewCookieJarSessions(CookieJarSessionsOptions{Store: store})
+	require.NoError(t, err)
+	defer sessions.Close(ctx)
+
+	v := &VE{cj: newTestCookieJar(t)}
+	assert.Empty(t, v.SessionID())
+	require.NoError(t, v.SaveCookieJar(ctx), "saving an in-memory jar is a no-op")
+
+	require.NoError(t, v.SetSessionID(ctx, sessions, "session-1"))
+	assert.Equal(t, "session-1", v.SessionID())
+	v.CookieJar().SetCookies(veURL, []*http.Cookie{{Name: "ASP.NET_SessionId", Value: "session"}})
+	require.NoError(t, v.SaveCookieJar(ctx))
+
+	data, err := store.Load(ctx, "session-1")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "ASP.NET_SessionId")
+}
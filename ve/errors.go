@@ -0,0 +1,209 @@
+package ve
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// bodySnippetLength is the maximum length of the body kept in a StatusError
+const bodySnippetLength = 256
+
+var (
+	// ErrProxy matches a ProxyError via errors.Is
+	ErrProxy = errors.New("proxy error")
+	// ErrTimeout matches a TimeoutError via errors.Is
+	ErrTimeout = errors.New("timeout error")
+	// ErrTLS matches a TLSError via errors.Is
+	ErrTLS = errors.New("tls error")
+	// ErrStatus matches a StatusError via errors.Is
+	ErrStatus = errors.New("bad status error")
+)
+
+// RequestError holds the details of a failed request that are common to all the request errors
+type RequestError struct {
+	Method string
+	URL    string
+	// ProxyID is the [proxstore.Proxy.ID] of the proxy the request was sent through
+	ProxyID string
+	// Attempt is the number of the attempt that failed, starting from 1
+	Attempt int
+	Err     error
+}
+
+func (e *RequestError) Error() string {
+	msg := fmt.Sprintf("%s %s failed on attempt %d", e.Method, e.URL, e.Attempt)
+	if e.ProxyID != "" {
+		msg += " via " + e.ProxyID
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// ProxyFault reports whether the proxy is to blame for the failure, used by the proxstore health scoring
+func (e *RequestError) ProxyFault() bool {
+	return false
+}
+
+// ProxyError is returned when the request couldn't go through the proxy,
+// e.g., the proxy refused the connection or its authentication failed
+type ProxyError struct {
+	RequestError
+	// StatusCode is the status returned by the proxy, 0 if there was none
+	StatusCode int
+}
+
+func (e *ProxyError) Error() string {
+	return "proxy error: " + e.RequestError.Error()
+}
+
+func (e *ProxyError) Is(target error) bool {
+	return target == ErrProxy
+}
+
+func (e *ProxyError) ProxyFault() bool {
+	return true
+}
+
+// TimeoutError is returned when the request timed out, either dialing or waiting for the response
+type TimeoutError struct {
+	RequestError
+}
+
+func (e *TimeoutError) Error() string {
+	return "timeout: " + e.RequestError.Error()
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// ProxyFault reports true when the request went through a proxy, as a slow exit is the most common cause of the
+// timeouts through one
+func (e *TimeoutError) ProxyFault() bool {
+	return e.ProxyID != ""
+}
+
+// TLSError is returned when the TLS handshake with the target failed
+type TLSError struct {
+	RequestError
+}
+
+func (e *TLSError) Error() string {
+	return "tls error: " + e.RequestError.Error()
+}
+
+func (e *TLSError) Is(target error) bool {
+	return target == ErrTLS
+}
+
+// StatusError is returned when the target responded with a status that is a failure,
+// i.e., 429 or 5xx
+type StatusError struct {
+	RequestError
+	StatusCode  int
+	BodySnippet string
+	// RetryAfter is the parsed Retry-After header of the response, 0 if there was none
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad status %d: %s", e.StatusCode, e.RequestError.Error())
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrStatus
+}
+
+// ProxyFault reports true for 429, as the rate limit is usually bound to the exit ip
+func (e *StatusError) ProxyFault() bool {
+	return e.StatusCode == 429 && e.ProxyID != ""
+}
+
+// IsStatusFailure reports whether the status code is turned into a StatusError by [Requester.Do]
+func IsStatusFailure(statusCode int) bool {
+	return statusCode == 429 || statusCode >= 500
+}
+
+// classifyError wraps the transport error into the matching request error
+func classifyError(base RequestError, err error) error {
+	base.Err = err
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.Is(err, context.Canceled):
+		return &base
+	case isTimeout(err, msg):
+		return &TimeoutError{RequestError: base}
+	case base.ProxyID != "" && isProxyFailure(err, msg):
+		pe := &ProxyError{RequestError: base}
+		if i := strings.Index(msg, "non 200 code: "); i >= 0 {
+			if fields := strings.Fields(msg[i+len("non 200 code: "):]); len(fields) > 0 {
+				pe.StatusCode, _ = strconv.Atoi(fields[0])
+			}
+		}
+		return pe
+	case strings.Contains(msg, "tls:") || strings.Contains(msg, "x509") || strings.Contains(msg, "handshake"):
+		return &TLSError{RequestError: base}
+	}
+	return &base
+}
+
+func isTimeout(err error, msg string) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return strings.Contains(msg, "timeout") || strings.Contains(msg, "deadline exceeded")
+}
+
+func isProxyFailure(err error, msg string) bool {
+	if strings.Contains(msg, "proxy") || strings.Contains(msg, "socks") {
+		return true
+	}
+	// Every connection is dialed to the proxy, so dial failures are the proxy's
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter parses the Retry-After header, either in seconds or as a http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := time.Parse(time.RFC1123, value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// bodySnippet returns the first bodySnippetLength bytes of the body, without cutting a rune in half
+func bodySnippet(body string) string {
+	if len(body) <= bodySnippetLength {
+		return body
+	}
+	end := bodySnippetLength
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+	return body[:end]
+}
@@ -0,0 +1,96 @@
+package ve
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve/har"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	base := RequestError{Method: "GET", URL: "https://ve.cbi.ir/", ProxyID: "http://user@127.0.0.1:8080", Attempt: 1}
+
+	err := classifyError(base, errors.Wrap(context.DeadlineExceeded, "dial"))
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, timeoutErr.ProxyFault())
+	direct := base
+	direct.ProxyID = ""
+	assert.False(t, (&TimeoutError{RequestError: direct}).ProxyFault(), "a direct timeout isn't the fault of a proxy")
+
+	err = classifyError(base, errors.New("Proxy responded with non 200 code: 407 Proxy Authentication Required"))
+	var proxyErr *ProxyError
+	require.ErrorAs(t, err, &proxyErr)
+	assert.Equal(t, 407, proxyErr.StatusCode)
+	assert.ErrorIs(t, err, ErrProxy)
+	assert.Contains(t, err.Error(), "http://user@127.0.0.1:8080")
+	err = classifyError(base, errors.New("Proxy responded with non 200 code: "))
+	require.ErrorAs(t, err, &proxyErr, "a proxy error without the status must not panic")
+	assert.Zero(t, proxyErr.StatusCode)
+
+	err = classifyError(base, errors.New("remote error: tls: handshake failure"))
+	assert.ErrorIs(t, err, ErrTLS)
+
+	err = classifyError(base, context.Canceled)
+	var requestErr *RequestError
+	require.ErrorAs(t, err, &requestErr)
+	assert.NotErrorIs(t, err, ErrProxy)
+}
+
+func TestRequesterStatusError(t *testing.T) {
+	h := har.New()
+	h.Log.Entries = append(
+		h.Log.Entries, &har.Entry{
+			Request: har.Request{Method: "GET", URL: "https://ve.cbi.ir/DefaultVE.aspx"},
+			Response: har.Response{
+				Status:      503,
+				StatusText:  "Service Unavailable",
+				HTTPVersion: "HTTP/1.1",
+				Headers:     []har.NameValue{{Name: "Retry-After", Value: "7"}},
+				Content:     har.Content{MimeType: "text/html", Text: "maintenance"},
+			},
+		},
+	)
+	proxy := proxstore.NewProxy[tls_client.HttpClient]("127.0.0.1", 8080, proxstore.ProtocolHttp)
+
+	resp, _, err := NewRequest[any](nil, "GET", "https://ve.cbi.ir/DefaultVE.aspx").
+		SetClient(har.NewClient(h, har.MatchLenient)).
+		SetProxy(proxy).
+		SetRetry().
+		SetMaxRetries(1).
+		Do()
+	require.NotNil(t, resp, "the response must be returned along with the error")
+
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.ErrorIs(t, err, ErrStatus)
+	assert.Equal(t, 503, statusErr.StatusCode)
+	assert.Equal(t, "maintenance", statusErr.BodySnippet)
+	assert.Equal(t, 7*time.Second, statusErr.RetryAfter)
+	assert.Equal(t, 2, statusErr.Attempt)
+	assert.Equal(t, "http://127.0.0.1:8080", statusErr.ProxyID)
+
+	// a 5xx of the target is not the fault of the proxy
+	assert.Equal(t, 1.0, proxy.Health().Score)
+	proxy.ReportFailure(&ProxyError{})
+	assert.Less(t, proxy.Health().Score, 1.0)
+	assert.EqualValues(t, 1, proxy.Health().ConsecutiveFailures)
+}
+
+func TestBodySnippet(t *testing.T) {
+	body := strings.Repeat("a", bodySnippetLength-1) + "سلام"
+	snippet := bodySnippet(body)
+	assert.True(t, utf8.ValidString(snippet), "a rune must not be cut in half")
+	assert.Equal(t, strings.Repeat("a", bodySnippetLength-1), snippet)
+	assert.Equal(t, "سلام", bodySnippet("سلام"))
+}
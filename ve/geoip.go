@@ -0,0 +1,72 @@
+package ve
+
+import (
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/pkg/errors"
+	"net"
+)
+
+// GeoIP enriches the exits with the country and ASN from local MaxMind-format databases,
+// e.g., GeoLite2-Country and GeoLite2-ASN
+type GeoIP struct {
+	readers []*maxminddb.Reader
+}
+
+// geoIPRecord holds the fields of both the country and the ASN databases
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// OpenGeoIP opens the .mmdb databases, the later ones fill in what the former ones miss
+func OpenGeoIP(paths ...string) (*GeoIP, error) {
+	g := &GeoIP{}
+	for _, path := range paths {
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			_ = g.Close()
+			return nil, errors.Wrapf(err, "failed to open geoip database %s", path)
+		}
+		g.readers = append(g.readers, reader)
+	}
+	return g, nil
+}
+
+// Enrich fills in the country, ASN and organization of the exit from its IP
+func (g *GeoIP) Enrich(exit *proxstore.Exit) error {
+	ip := net.ParseIP(exit.IP)
+	if ip == nil {
+		return errors.Wrapf(ErrInvalidIP, "can't look %q up", exit.IP)
+	}
+	for _, reader := range g.readers {
+		var record geoIPRecord
+		if err := reader.Lookup(ip, &record); err != nil {
+			return errors.Wrap(err, "failed to look ip up")
+		}
+		if exit.Country == "" {
+			exit.Country = record.Country.ISOCode
+		}
+		if exit.ASN == 0 {
+			exit.ASN = record.ASN
+		}
+		if exit.Organization == "" {
+			exit.Organization = record.Organization
+		}
+	}
+	return nil
+}
+
+// Close closes the databases
+func (g *GeoIP) Close() error {
+	var err error
+	for _, reader := range g.readers {
+		if errClose := reader.Close(); errClose != nil && err == nil {
+			err = errClose
+		}
+	}
+	return err
+}
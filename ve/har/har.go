@@ -0,0 +1,147 @@
+package har
+
+import (
+	"encoding/base64"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"os"
+	"time"
+)
+
+const (
+	Version     = "1.2"
+	CreatorName = "Couploan"
+)
+
+// HAR is the root of a HAR 1.2 document
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string   `json:"version"`
+	Creator Creator  `json:"creator"`
+	Entries []*Entry `json:"entries"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is a single recorded request and its response
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+	// Comment holds the error message in case the request failed without a response
+	Comment string `json:"comment,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Cookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HTTPOnly bool       `json:"httpOnly,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+}
+
+type PostData struct {
+	MimeType string      `json:"mimeType"`
+	Params   []NameValue `json:"params,omitempty"`
+	Text     string      `json:"text"`
+}
+
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	// Encoding is "base64" when Text holds a binary body
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// New creates an empty HAR document
+func New() *HAR {
+	return &HAR{
+		Log: Log{
+			Version: Version,
+			Creator: Creator{Name: CreatorName, Version: Version},
+			Entries: []*Entry{},
+		},
+	}
+}
+
+// Load reads a HAR document from the file
+func Load(path string) (*HAR, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = errors.Wrap(err, "failed to read har file")
+		return nil, err
+	}
+	h := &HAR{}
+	if err = json.Unmarshal(data, h); err != nil {
+		err = errors.Wrap(err, "failed to parse har file")
+		return nil, err
+	}
+	return h, nil
+}
+
+// Save writes the HAR document to the file
+func (h *HAR) Save(path string) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal har")
+	}
+	if err = os.WriteFile(path, data, 0o644); err != nil {
+		return errors.Wrap(err, "failed to write har file")
+	}
+	return nil
+}
+
+// Body returns the decoded response body
+func (c Content) Body() ([]byte, error) {
+	if c.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(c.Text)
+	}
+	return []byte(c.Text), nil
+}
@@ -0,0 +1,267 @@
+package har
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/Dissociable/Couploan/ve/util"
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Redacted replaces the values of redacted headers, cookies and params
+const Redacted = "REDACTED"
+
+var (
+	// DefaultRedactHeaders are the headers that are redacted when no RecorderOptions are given
+	DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+	// DefaultRedactParams are the query and form params that are redacted when no RecorderOptions are given
+	DefaultRedactParams = []string{"key", "apiKey", "api_key", "token", "password", "proxy"}
+)
+
+type RecorderOptions struct {
+	// RedactHeaders are the names of the headers whose values are redacted, case-insensitive
+	//
+	// Redacting Cookie or Set-Cookie redacts the values of the recorded cookies too
+	RedactHeaders []string
+	// RedactParams are the names of the query string and form params whose values are redacted
+	RedactParams []string
+}
+
+// Recorder records every request and response passing through its Intercept into a HAR document
+type Recorder struct {
+	mu      sync.Mutex
+	har     *HAR
+	options RecorderOptions
+}
+
+// NewRecorder creates a new recorder, nil options use the default redactions
+func NewRecorder(options *RecorderOptions) *Recorder {
+	if options == nil {
+		options = &RecorderOptions{
+			RedactHeaders: DefaultRedactHeaders,
+			RedactParams:  DefaultRedactParams,
+		}
+	}
+	return &Recorder{
+		har:     New(),
+		options: *options,
+	}
+}
+
+// Intercept is a [util.Interceptor] that records the request and its response,
+// use it with [ve.Requester.AddInterceptor]
+func (r *Recorder) Intercept(req *http.Request, next util.DoFunc) (*http.Response, error) {
+	entry := &Entry{StartedDateTime: time.Now()}
+	var err error
+	entry.Request, err = r.buildRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := next(req)
+	elapsed := float64(time.Since(entry.StartedDateTime).Microseconds()) / 1000
+	entry.Time = elapsed
+	entry.Timings = Timings{Send: 0, Wait: elapsed, Receive: 0}
+	if err != nil {
+		entry.Comment = err.Error()
+		r.add(entry)
+		return resp, err
+	}
+
+	entry.Response, err = r.buildResponse(resp)
+	if err != nil {
+		return resp, err
+	}
+	r.add(entry)
+	return resp, nil
+}
+
+// HAR returns a copy of the recorded document
+func (r *Recorder) HAR() *HAR {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := New()
+	h.Log.Entries = slices.Clone(r.har.Log.Entries)
+	return h
+}
+
+// Save writes the recorded document to the file
+func (r *Recorder) Save(path string) error {
+	return r.HAR().Save(path)
+}
+
+func (r *Recorder) add(entry *Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.har.Log.Entries = append(r.har.Log.Entries, entry)
+}
+
+func (r *Recorder) buildRequest(req *http.Request) (hr Request, err error) {
+	u := *req.URL
+	query := u.Query()
+	r.redactValues(query)
+	u.RawQuery = query.Encode()
+
+	hr = Request{
+		Method:      req.Method,
+		URL:         u.String(),
+		HTTPVersion: httpVersion(req.Proto),
+		Headers:     r.headers(req.Header),
+		QueryString: nameValues(query),
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	for _, c := range req.Cookies() {
+		hr.Cookies = append(hr.Cookies, r.cookie(c, "Cookie"))
+	}
+	if hr.Cookies == nil {
+		hr.Cookies = []Cookie{}
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		err = errors.Wrap(err, "failed to read request body for har")
+		return
+	}
+	_ = req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	hr.BodySize = len(body)
+
+	contentType := req.Header.Get("Content-Type")
+	hr.PostData = &PostData{MimeType: contentType, Text: string(body)}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == util.ContentTypeForm {
+		form, errParse := url.ParseQuery(string(body))
+		if errParse == nil {
+			r.redactValues(form)
+			hr.PostData.Params = nameValues(form)
+			hr.PostData.Text = form.Encode()
+		}
+	}
+	return
+}
+
+func (r *Recorder) buildResponse(resp *http.Response) (hr Response, err error) {
+	hr = Response{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: httpVersion(resp.Proto),
+		Headers:     r.headers(resp.Header),
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		Cookies:     []Cookie{},
+	}
+	for _, c := range resp.Cookies() {
+		hr.Cookies = append(hr.Cookies, r.cookie(c, "Set-Cookie"))
+	}
+
+	var body []byte
+	if resp.Body != nil {
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			err = errors.Wrap(err, "failed to read response body for har")
+			return
+		}
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	hr.BodySize = len(body)
+	hr.Content = Content{Size: len(body), MimeType: resp.Header.Get("Content-Type")}
+	if utf8.Valid(body) {
+		hr.Content.Text = string(body)
+	} else {
+		hr.Content.Text = base64.StdEncoding.EncodeToString(body)
+		hr.Content.Encoding = "base64"
+	}
+	return
+}
+
+func (r *Recorder) headers(h http.Header) []NameValue {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		if k == http.HeaderOrderKey || k == http.PHeaderOrderKey {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	pairs := make([]NameValue, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range h[k] {
+			if r.isRedactedHeader(k) {
+				v = Redacted
+			}
+			pairs = append(pairs, NameValue{Name: k, Value: v})
+		}
+	}
+	return pairs
+}
+
+func (r *Recorder) cookie(c *http.Cookie, header string) Cookie {
+	hc := Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		HTTPOnly: c.HttpOnly,
+		Secure:   c.Secure,
+	}
+	if !c.Expires.IsZero() {
+		expires := c.Expires
+		hc.Expires = &expires
+	}
+	if r.isRedactedHeader(header) {
+		hc.Value = Redacted
+	}
+	return hc
+}
+
+func (r *Recorder) isRedactedHeader(name string) bool {
+	return slices.ContainsFunc(
+		r.options.RedactHeaders, func(s string) bool {
+			return strings.EqualFold(s, name)
+		},
+	)
+}
+
+func (r *Recorder) redactValues(values url.Values) {
+	for _, name := range r.options.RedactParams {
+		if vs, ok := values[name]; ok {
+			for i := range vs {
+				vs[i] = Redacted
+			}
+		}
+	}
+}
+
+func nameValues(values url.Values) []NameValue {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	pairs := make([]NameValue, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range values[k] {
+			pairs = append(pairs, NameValue{Name: k, Value: v})
+		}
+	}
+	return pairs
+}
+
+func httpVersion(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+	return proto
+}
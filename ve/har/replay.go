@@ -0,0 +1,275 @@
+package har
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Dissociable/Couploan/ve/util"
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/bandwidth"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MatchMode determines how the replay client matches requests to the recorded entries
+type MatchMode int
+
+const (
+	// MatchStrict matches the method, the full url and the body, every entry is served once
+	//
+	// Redacted values in the recording match any value.
+	MatchStrict MatchMode = iota
+	// MatchLenient matches the method, scheme, host and path, entries are served in order
+	// and the last matching entry is served again once they run out
+	MatchLenient
+)
+
+var ErrNoMatchingEntry = errors.New("no matching har entry for the request")
+
+// Client is a [tls_client.HttpClient] that serves the responses from a HAR document instead of the network
+type Client struct {
+	mu             sync.Mutex
+	entries        []*Entry
+	served         []bool
+	mode           MatchMode
+	jar            http.CookieJar
+	proxy          string
+	followRedirect bool
+}
+
+// NewClient creates a replay client serving the entries of h
+func NewClient(h *HAR, mode MatchMode) *Client {
+	var entries []*Entry
+	for _, e := range h.Log.Entries {
+		// Failed requests have no response to replay
+		if e.Response.Status == 0 {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return &Client{
+		entries: entries,
+		served:  make([]bool, len(entries)),
+		mode:    mode,
+	}
+}
+
+// NewClientFromFile creates a replay client serving the entries of the HAR file
+func NewClientFromFile(path string, mode MatchMode) (*Client, error) {
+	h, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(h, mode), nil
+}
+
+// Remaining returns the number of entries that haven't been served yet
+func (c *Client) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, s := range c.served {
+		if !s {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			err = errors.Wrap(err, "failed to read request body")
+			return nil, err
+		}
+		_ = req.Body.Close()
+	}
+
+	entry := c.match(req, body)
+	if entry == nil {
+		return nil, errors.Wrapf(ErrNoMatchingEntry, "%s %s", req.Method, req.URL.String())
+	}
+
+	respBody, err := entry.Response.Content.Body()
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode recorded response body")
+		return nil, err
+	}
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Response.Status, entry.Response.StatusText),
+		StatusCode:    entry.Response.Status,
+		Proto:         entry.Response.HTTPVersion,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(resp.Proto)
+	for _, h := range entry.Response.Headers {
+		if strings.EqualFold(h.Name, "Content-Length") {
+			continue
+		}
+		resp.Header.Add(h.Name, h.Value)
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(respBody)))
+
+	if c.jar != nil {
+		if cookies := resp.Cookies(); len(cookies) > 0 {
+			c.jar.SetCookies(req.URL, cookies)
+		}
+	}
+	return resp, nil
+}
+
+func (c *Client) match(req *http.Request, body []byte) *Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := -1
+	for i, e := range c.entries {
+		if !c.matches(e, req, body) {
+			continue
+		}
+		if !c.served[i] {
+			c.served[i] = true
+			return e
+		}
+		last = i
+	}
+	if c.mode == MatchLenient && last >= 0 {
+		return c.entries[last]
+	}
+	return nil
+}
+
+func (c *Client) matches(e *Entry, req *http.Request, body []byte) bool {
+	if !strings.EqualFold(e.Request.Method, req.Method) {
+		return false
+	}
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(u.Scheme, req.URL.Scheme) ||
+		!strings.EqualFold(u.Host, req.URL.Host) ||
+		strings.TrimSuffix(u.Path, "/") != strings.TrimSuffix(req.URL.Path, "/") {
+		return false
+	}
+	if c.mode == MatchLenient {
+		return true
+	}
+	if !valuesMatch(u.Query(), req.URL.Query()) {
+		return false
+	}
+	var recorded string
+	if e.Request.PostData != nil {
+		recorded = e.Request.PostData.Text
+	}
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == util.ContentTypeForm {
+		recordedForm, errRecorded := url.ParseQuery(recorded)
+		form, errForm := url.ParseQuery(string(body))
+		if errRecorded == nil && errForm == nil {
+			return valuesMatch(recordedForm, form)
+		}
+	}
+	return recorded == string(body)
+}
+
+// valuesMatch reports whether the values equal the recorded ones, a redacted recorded value matches any value
+func valuesMatch(recorded url.Values, values url.Values) bool {
+	if len(recorded) != len(values) {
+		return false
+	}
+	for k, rvs := range recorded {
+		vs, ok := values[k]
+		if !ok || len(vs) != len(rvs) {
+			return false
+		}
+		for i := range rvs {
+			if rvs[i] != Redacted && rvs[i] != vs[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (c *Client) GetCookies(u *url.URL) []*http.Cookie {
+	if c.jar == nil {
+		return nil
+	}
+	return c.jar.Cookies(u)
+}
+
+func (c *Client) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if c.jar == nil {
+		return
+	}
+	c.jar.SetCookies(u, cookies)
+}
+
+func (c *Client) SetCookieJar(jar http.CookieJar) {
+	c.jar = jar
+}
+
+func (c *Client) GetCookieJar() http.CookieJar {
+	return c.jar
+}
+
+func (c *Client) SetProxy(proxyUrl string) error {
+	c.proxy = proxyUrl
+	return nil
+}
+
+func (c *Client) GetProxy() string {
+	return c.proxy
+}
+
+func (c *Client) SetFollowRedirect(followRedirect bool) {
+	c.followRedirect = followRedirect
+}
+
+func (c *Client) GetFollowRedirect() bool {
+	return c.followRedirect
+}
+
+func (c *Client) CloseIdleConnections() {}
+
+func (c *Client) Get(url string) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *Client) Head(url string) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *Client) Post(url, contentType string, body io.Reader) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req)
+}
+
+func (c *Client) GetBandwidthTracker() bandwidth.BandwidthTracker {
+	return bandwidth.NewNopeTracker()
+}
+
+// Ensure interface compatibility
+var _ tls_client.HttpClient = (*Client)(nil)
@@ -0,0 +1,304 @@
+// Package httpcache caches the responses of the idempotent requests as an interceptor of [ve.Requester],
+// honouring Cache-Control, Expires, ETag and Last-Modified with conditional revalidation
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/Dissociable/Couploan/ve/util"
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrCacheMiss = errors.New("cache miss")
+
+// Store keeps the cached responses
+type Store interface {
+	// Get returns the data of the key, ErrCacheMiss if there is none
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores the data of the key, it expires after ttl
+	Set(ctx context.Context, key string, data []byte, ttl time.Duration) error
+	// Delete removes the data of the key
+	Delete(ctx context.Context, key string) error
+}
+
+type Options struct {
+	// Store keeps the cached responses, required
+	Store Store
+	// VaryHeaders are the request headers that are part of the key, in addition to the method and the url,
+	// the responses varying on any other header aren't cached
+	VaryHeaders []string
+	// DefaultTTL is the freshness of the responses without Cache-Control or Expires,
+	// 0 means they are only cached for revalidation if they have a validator
+	DefaultTTL time.Duration
+	// StaleTTL is how long a response with a validator is kept after it becomes stale, defaults to 24 hours
+	StaleTTL time.Duration
+	// MaxBodySize is the maximum size of a cached body, defaults to 1MB
+	MaxBodySize int
+	// HonorRequestCacheControl makes the no-store and no-cache directives of the requests bypass the cache,
+	// off by default as the browser like default headers always send them
+	HonorRequestCacheControl bool
+}
+
+// Cache caches the responses of GET and HEAD requests
+type Cache struct {
+	options Options
+}
+
+type entry struct {
+	StatusCode int         `json:"statusCode"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	FreshUntil time.Time   `json:"freshUntil"`
+}
+
+// New creates a cache over the store of the options
+func New(options Options) (*Cache, error) {
+	if options.Store == nil {
+		return nil, errors.New("http cache requires a store")
+	}
+	if options.StaleTTL <= 0 {
+		options.StaleTTL = 24 * time.Hour
+	}
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = 1 << 20
+	}
+	return &Cache{options: options}, nil
+}
+
+// Intercept caches the responses in the global scope, to be added via [ve.Requester.AddInterceptor]
+func (c *Cache) Intercept(req *http.Request, next util.DoFunc) (*http.Response, error) {
+	return c.intercept(req, next, "", c.options.DefaultTTL)
+}
+
+// Interceptor returns an interceptor caching the responses in the scope,
+// e.g., the proxy id for the responses that depend on the exit ip
+//
+// defaultTTL overrides [Options.DefaultTTL] for this interceptor if it's positive
+func (c *Cache) Interceptor(scope string, defaultTTL time.Duration) util.Interceptor {
+	if defaultTTL <= 0 {
+		defaultTTL = c.options.DefaultTTL
+	}
+	return func(req *http.Request, next util.DoFunc) (*http.Response, error) {
+		return c.intercept(req, next, scope, defaultTTL)
+	}
+}
+
+func (c *Cache) intercept(req *http.Request, next util.DoFunc, scope string, defaultTTL time.Duration) (
+	*http.Response, error,
+) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return next(req)
+	}
+	var noCache bool
+	if c.options.HonorRequestCacheControl {
+		reqDirectives := parseCacheControl(req.Header.Get("Cache-Control"))
+		if _, ok := reqDirectives["no-store"]; ok {
+			return next(req)
+		}
+		_, noCache = reqDirectives["no-cache"]
+	}
+	ctx := req.Context()
+	key := c.key(req, scope)
+
+	cached := c.load(ctx, key)
+	if cached != nil && !noCache && time.Now().Before(cached.FreshUntil) {
+		return cached.response(req), nil
+	}
+
+	if cached != nil {
+		etag, lastModified := cached.Header.Get("ETag"), cached.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			req = req.Clone(ctx)
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				req.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+
+	resp, err := next(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		for name, values := range resp.Header {
+			if !strings.EqualFold(name, "Set-Cookie") {
+				cached.Header[name] = values
+			}
+		}
+		if c.cacheable(cached.Header) {
+			c.store(ctx, key, cached, defaultTTL)
+		} else {
+			_ = c.options.Store.Delete(ctx, key)
+		}
+		return cached.response(req), nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	if !c.cacheable(resp.Header) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(c.options.MaxBodySize)+1))
+	_ = resp.Body.Close()
+	if err != nil {
+		err = errors.Wrap(err, "failed to read response body")
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) > c.options.MaxBodySize {
+		return resp, nil
+	}
+
+	e := &entry{
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+	}
+	// The cookies belong to the session that got them, they must not be replayed to the others
+	e.Header.Del("Set-Cookie")
+	c.store(ctx, key, e, defaultTTL)
+	return resp, nil
+}
+
+// cacheable returns whether a response with the header may be stored
+//
+// The private responses belong to the session that got them, like the cookies, and the responses varying on the
+// request headers which aren't part of the key would be served to the requests they don't match.
+func (c *Cache) cacheable(header http.Header) bool {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if _, ok := directives["private"]; ok {
+		return false
+	}
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !c.varies(name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// varies returns whether the request header is one of the vary headers of the key
+func (c *Cache) varies(name string) bool {
+	for _, header := range c.options.VaryHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// key builds the key of the request from its method, url, vary headers and the scope
+func (c *Cache) key(req *http.Request, scope string) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + "\n" + req.URL.String() + "\n" + scope))
+	for _, name := range c.options.VaryHeaders {
+		h.Write([]byte("\n" + name + ":" + strings.Join(req.Header.Values(name), ",")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) load(ctx context.Context, key string) *entry {
+	data, err := c.options.Store.Get(ctx, key)
+	if err != nil {
+		return nil
+	}
+	e := &entry{}
+	if err = json.Unmarshal(data, e); err != nil {
+		return nil
+	}
+	return e
+}
+
+// store saves the entry with the freshness of its headers, if it's worth caching
+func (c *Cache) store(ctx context.Context, key string, e *entry, defaultTTL time.Duration) {
+	freshness := freshnessOf(e.Header, defaultTTL)
+	e.FreshUntil = time.Now().Add(freshness)
+	ttl := freshness
+	if e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != "" {
+		ttl += c.options.StaleTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	_ = c.options.Store.Set(ctx, key, data, ttl)
+}
+
+func (e *entry) response(req *http.Request) *http.Response {
+	resp := &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         e.Proto,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(resp.Proto)
+	return resp
+}
+
+// freshnessOf returns how long the response is fresh for according to its headers
+func freshnessOf(header http.Header, defaultTTL time.Duration) time.Duration {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-cache"]; ok {
+		return 0
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil || seconds < 0 {
+			return 0
+		}
+		age, _ := strconv.Atoi(header.Get("Age"))
+		return time.Duration(seconds-age) * time.Second
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return time.Until(t)
+	}
+	return defaultTTL
+}
+
+// parseCacheControl parses the directives of a Cache-Control header, lower-cased
+func parseCacheControl(value string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return directives
+}
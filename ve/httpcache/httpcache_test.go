@@ -0,0 +1,151 @@
+package httpcache
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/ve/util"
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, data []byte, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = data
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+// origin is a fake server answering with its headers, 304 when the etag matches
+type origin struct {
+	header http.Header
+	body   string
+	hits   int
+}
+
+func (o *origin) do(req *http.Request) (*http.Response, error) {
+	o.hits++
+	header := o.header.Clone()
+	if etag := header.Get("ETag"); etag != "" && req.Header.Get("If-None-Match") == etag {
+		return &http.Response{StatusCode: 304, Header: header, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	return &http.Response{StatusCode: 200, Header: header, Body: io.NopCloser(strings.NewReader(o.body))}, nil
+}
+
+func get(t *testing.T, do util.DoFunc, link string) string {
+	req, err := util.BuildRequest("GET", link, http.Header{}, nil)
+	require.NoError(t, err)
+	_, body, err := util.DoRequest(context.Background(), do, req)
+	require.NoError(t, err)
+	return body
+}
+
+func newTestCache(t *testing.T) *Cache {
+	c, err := New(Options{Store: &memoryStore{data: map[string][]byte{}}})
+	require.NoError(t, err)
+	return c
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	o := &origin{
+		header: http.Header{"Cache-Control": {"public, max-age=60"}, "Set-Cookie": {"session=secret"}},
+		body:   "203.0.113.7",
+	}
+	c := newTestCache(t)
+	do := util.ChainInterceptors(o.do, c.Intercept)
+
+	assert.Equal(t, "203.0.113.7", get(t, do, "https://api.ipify.org"))
+	assert.Equal(t, "203.0.113.7", get(t, do, "https://api.ipify.org"))
+	assert.Equal(t, 1, o.hits)
+
+	req, err := util.BuildRequest("GET", "https://api.ipify.org", nil, nil)
+	require.NoError(t, err)
+	resp, err := do(req)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get("Set-Cookie"), "cookies must not be replayed from the cache")
+
+	// another scope, e.g., another proxy, has its own entries
+	scoped := util.ChainInterceptors(o.do, c.Interceptor("http://127.0.0.1:8080", 0))
+	get(t, scoped, "https://api.ipify.org")
+	assert.Equal(t, 2, o.hits)
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	o := &origin{header: http.Header{"Cache-Control": {"no-cache"}, "ETag": {`"v1"`}}, body: "page"}
+	c := newTestCache(t)
+	do := util.ChainInterceptors(o.do, c.Intercept)
+
+	assert.Equal(t, "page", get(t, do, "https://ve.cbi.ir/DefaultVE.aspx"))
+	assert.Equal(t, "page", get(t, do, "https://ve.cbi.ir/DefaultVE.aspx"), "a 304 must be served from the cache")
+	assert.Equal(t, 2, o.hits)
+
+	o.header.Set("ETag", `"v2"`)
+	o.body = "new page"
+	assert.Equal(t, "new page", get(t, do, "https://ve.cbi.ir/DefaultVE.aspx"))
+}
+
+func TestCacheNoStore(t *testing.T) {
+	o := &origin{header: http.Header{"Cache-Control": {"no-store"}}, body: "secret"}
+	c := newTestCache(t)
+	do := util.ChainInterceptors(o.do, c.Interceptor("", time.Hour))
+
+	get(t, do, "https://ve.cbi.ir/")
+	get(t, do, "https://ve.cbi.ir/")
+	assert.Equal(t, 2, o.hits)
+}
+
+func TestCachePrivate(t *testing.T) {
+	o := &origin{header: http.Header{"Cache-Control": {"private, max-age=60"}}, body: "account"}
+	c := newTestCache(t)
+	do := util.ChainInterceptors(o.do, c.Intercept)
+
+	get(t, do, "https://ve.cbi.ir/")
+	get(t, do, "https://ve.cbi.ir/")
+	assert.Equal(t, 2, o.hits)
+}
+
+func TestCacheVary(t *testing.T) {
+	o := &origin{header: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Language"}}, body: "page"}
+	c := newTestCache(t)
+	do := util.ChainInterceptors(o.do, c.Intercept)
+
+	get(t, do, "https://ve.cbi.ir/")
+	get(t, do, "https://ve.cbi.ir/")
+	assert.Equal(t, 2, o.hits, "a response varying on a header that isn't part of the key must not be cached")
+
+	c, err := New(
+		Options{Store: &memoryStore{data: map[string][]byte{}}, VaryHeaders: []string{"accept-language"}},
+	)
+	require.NoError(t, err)
+	do = util.ChainInterceptors(o.do, c.Intercept)
+	get(t, do, "https://ve.cbi.ir/")
+	get(t, do, "https://ve.cbi.ir/")
+	assert.Equal(t, 3, o.hits)
+}
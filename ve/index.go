@@ -15,14 +15,21 @@ func (ve *VE) Index(ctx context.Context) (ip string, err error) {
 	// 		},
 	// 	},
 	// )
-	_, body, err := NewRequest(ve, "GET", "https://ve.cbi.ir/DefaultVE.aspx").
+	requester := NewRequest(ve, "GET", ve.Target().URL("/DefaultVE.aspx")).
 		SetContext(ctx).
+		SetHeaders(ve.Target().DefaultHeaders()).
+		SetCircuitBreaker(ve.circuitBreaker).
 		SetGetClientFunc(getClientFunc).
 		SetGetCookieJarFunc(getCookieJarFunc).
 		SetProxy(ve.proxy).
 		SetRetry().
-		SetMaxRetries(3).
-		Do()
+		SetMaxRetries(3)
+	// The page is cached per session, as it sets the cookies of the session, a session which hasn't got them yet
+	// always loads it
+	if ve.responseCache != nil && ve.SessionID() != "" {
+		requester.AddInterceptor(ve.responseCache.Interceptor("session:"+ve.SessionID(), 0))
+	}
+	_, body, err := requester.Do()
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,70 @@
+package ve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve/har"
+	"github.com/Dissociable/Couploan/ve/httpcache"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapCacheStore is an in-memory httpcache.Store
+type mapCacheStore map[string][]byte
+
+func (s mapCacheStore) Get(_ context.Context, key string) ([]byte, error) {
+	data, ok := s[key]
+	if !ok {
+		return nil, httpcache.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (s mapCacheStore) Set(_ context.Context, key string, data []byte, _ time.Duration) error {
+	s[key] = data
+	return nil
+}
+
+func (s mapCacheStore) Delete(_ context.Context, key string) error {
+	delete(s, key)
+	return nil
+}
+
+// TestVE_IndexCache serves the index from the response cache of the session, but not to the other sessions
+func TestVE_IndexCache(t *testing.T) {
+	ctx := context.Background()
+	h := har.New()
+	for _, body := range []string{"page-1", "page-2"} {
+		entry := echoEntry(TargetProfileVE.URL("/DefaultVE.aspx"), 200, body)
+		entry.Response.Headers = []har.NameValue{{Name: "Cache-Control", Value: "max-age=60"}}
+		h.Log.Entries = append(h.Log.Entries, entry)
+	}
+	proxy := proxstore.NewProxy[tls_client.HttpClient]("127.0.0.1", 8080, proxstore.ProtocolHttp)
+	proxy.SetHttpClient(har.NewClient(h, har.MatchLenient), "ve")
+	responseCache, err := httpcache.New(httpcache.Options{Store: mapCacheStore{}})
+	require.NoError(t, err)
+	store, err := NewFileCookieJarStore(t.TempDir())
+	require.NoError(t, err)
+	sessions, err := NewCookieJarSessions(CookieJarSessionsOptions{Store: store})
+	require.NoError(t, err)
+	defer sessions.Close(ctx)
+	newSession := func(sessionID string) *VE {
+		v := (&VE{proxy: proxy}).SetResponseCache(responseCache)
+		require.NoError(t, v.SetSessionID(ctx, sessions, sessionID))
+		return v
+	}
+
+	first := newSession("session-1")
+	for range 2 {
+		page, err := first.Index(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "page-1", page)
+	}
+	page, err := newSession("session-2").Index(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "page-2", page, "another session must load the page of its own")
+}
@@ -3,69 +3,43 @@ package ve
 import (
 	"context"
 	"github.com/Dissociable/Couploan/proxstore"
-	tls_client "github.com/bogdanfinn/tls-client"
-	"github.com/bogdanfinn/tls-client/profiles"
 	"github.com/pkg/errors"
-	"strings"
+	"time"
 )
 
+// IP returns the exit ip of the proxy of the session, see [VE.Exit]
 func (ve *VE) IP(ctx context.Context) (ip string, err error) {
-	_, body, err := NewRequest(ve, "GET", "https://api.ipify.org").
-		SetContext(ctx).
-		SetGetClientFunc(getClientFunc).
-		SetProxy(ve.proxy).
-		SetRetry().
-		SetMaxRetries(3).
-		Do()
+	exit, err := ve.Exit(ctx)
 	if err != nil {
 		return "", err
 	}
-
-	body = strings.TrimSpace(body)
-	if body != "" {
-		ip = body
-	}
-	return
+	return exit.IP, nil
 }
 
-// CheckProxy checks if the proxy is valid and working,
-// if proxy been working and good http response returned, it returns nil
-func CheckProxy(ctx context.Context, proxy *proxstore.Proxy[tls_client.HttpClient]) (err error) {
-	if proxy == nil {
-		err = errors.New("no proxy is set")
-		return
+// Exit resolves the exit of the proxy of the session via the IPResolver, enriches it via the GeoIP if set
+// and stores it on the proxy as its observed exit
+//
+// The exit is returned along with proxstore.ErrExitCountryMismatch when the proxy exits from another country than
+// the one it claims, see [proxstore.Proxy.VerifyExitCountry]
+func (ve *VE) Exit(ctx context.Context) (exit proxstore.Exit, err error) {
+	resolver := ve.ipResolver
+	if resolver == nil {
+		resolver = NewEchoIPResolver()
 	}
-
-	c, err := tls_client.NewHttpClient(
-		tls_client.NewNoopLogger(),
-		tls_client.WithTimeoutSeconds(30),
-		tls_client.WithProxyUrl(proxy.String()),
-		tls_client.WithNotFollowRedirects(),
-		tls_client.WithClientProfile(profiles.Chrome_124),
-	)
+	exit, err = resolver.ResolveIP(ctx, ve)
 	if err != nil {
-		err = errors.Wrap(err, "failed to create http client")
-		return
+		return exit, err
 	}
-	resp, body, err := NewRequest[any](nil, "GET", "https://ve.cbi.ir/DefaultVE.aspx").
-		SetContext(ctx).
-		SetClient(c).
-		SetProxy(proxy).
-		Do()
-
-	if err != nil {
-		err = errors.Wrap(err, "failed to check proxy")
-		return
-	}
-
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		if strings.Contains(body, `window["bobcmn"]`) || strings.Contains(body, "ازدواج") {
-			return nil
-		} else {
-			err = errors.New("proxy is not working, couldn't verify response body")
-			return err
+	if ve.geoIP != nil {
+		if err = ve.geoIP.Enrich(&exit); err != nil {
+			err = errors.Wrap(err, "failed to enrich exit")
+			return exit, err
 		}
 	}
-
-	return errors.New("proxy is not working, bad response status code returned")
+	exit.ObservedAt = time.Now()
+	ve.proxy.SetObservedExit(exit)
+	if err = ve.proxy.VerifyExitCountry(); err != nil {
+		return exit, err
+	}
+	return exit, nil
 }
@@ -0,0 +1,102 @@
+package ve
+
+import (
+	"context"
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrIPNotResolved is returned when none of the endpoints of the resolver returned a valid ip
+	ErrIPNotResolved = errors.New("failed to resolve exit ip")
+	// ErrInvalidIP is returned when an endpoint responded with something that's not an ip
+	ErrInvalidIP = errors.New("invalid ip returned")
+)
+
+// IPResolver looks up the exit ip of the proxy of the session
+type IPResolver interface {
+	// ResolveIP returns the exit of the session, at least its IP and Source
+	ResolveIP(ctx context.Context, ve *VE) (proxstore.Exit, error)
+}
+
+// IPEndpoint is an endpoint echoing the ip of the caller
+type IPEndpoint struct {
+	URL string
+	// Parse extracts the ip from the response body, defaults to the trimmed body
+	Parse func(body string) string
+}
+
+var (
+	IPEndpointIpify     = IPEndpoint{URL: "https://api.ipify.org"}
+	IPEndpointIcanhazip = IPEndpoint{URL: "https://icanhazip.com"}
+	IPEndpointIfconfig  = IPEndpoint{URL: "https://ifconfig.me/ip"}
+	IPEndpointIpinfo    = IPEndpoint{
+		URL: "https://ipinfo.io/json",
+		Parse: func(body string) string {
+			return gjson.Get(body, "ip").String()
+		},
+	}
+)
+
+// EchoIPResolver resolves the exit ip via the echo endpoints, failing over to the next one on failure
+type EchoIPResolver struct {
+	Endpoints []IPEndpoint
+}
+
+// NewEchoIPResolver creates a resolver over the endpoints, in order, defaults to all the known endpoints
+func NewEchoIPResolver(endpoints ...IPEndpoint) *EchoIPResolver {
+	if len(endpoints) == 0 {
+		endpoints = []IPEndpoint{IPEndpointIpify, IPEndpointIcanhazip, IPEndpointIfconfig, IPEndpointIpinfo}
+	}
+	return &EchoIPResolver{Endpoints: endpoints}
+}
+
+func (r *EchoIPResolver) ResolveIP(ctx context.Context, ve *VE) (proxstore.Exit, error) {
+	var failures []string
+	for _, endpoint := range r.Endpoints {
+		if ctx.Err() != nil {
+			return proxstore.Exit{}, ctx.Err()
+		}
+		ip, err := ve.echoIP(ctx, endpoint)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		return proxstore.Exit{IP: ip, Source: endpoint.URL}, nil
+	}
+	return proxstore.Exit{}, errors.Wrap(ErrIPNotResolved, strings.Join(failures, "; "))
+}
+
+// echoIP gets the ip from the endpoint through the proxy of the session
+func (ve *VE) echoIP(ctx context.Context, endpoint IPEndpoint) (ip string, err error) {
+	r := NewRequest(ve, "GET", endpoint.URL).
+		SetContext(ctx).
+		SetCircuitBreaker(ve.circuitBreaker).
+		SetGetClientFunc(getClientFunc).
+		SetProxy(ve.proxy).
+		SetRetry().
+		SetMaxRetries(1)
+	// The exit ip is never cached, it changes whenever the proxy is released, maybe by another instance,
+	// and a stale one would be taken as a failed rotation, see proxstore.Proxy.SetObservedExit
+	resp, body, err := r.Do()
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", errors.Errorf("%s responded with status %d", endpoint.URL, resp.StatusCode)
+	}
+
+	if endpoint.Parse != nil {
+		ip = endpoint.Parse(body)
+	} else {
+		ip = body
+	}
+	ip = strings.TrimSpace(ip)
+	if net.ParseIP(ip) == nil {
+		return "", errors.Wrapf(ErrInvalidIP, "%s returned %q", endpoint.URL, bodySnippet(ip))
+	}
+	return ip, nil
+}
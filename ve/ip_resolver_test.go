@@ -0,0 +1,62 @@
+package ve
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve/har"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoEntry(link string, status int, body string) *har.Entry {
+	return &har.Entry{
+		Request: har.Request{Method: "GET", URL: link},
+		Response: har.Response{
+			Status:      status,
+			HTTPVersion: "HTTP/1.1",
+			Content:     har.Content{MimeType: "text/plain", Text: body},
+		},
+	}
+}
+
+// TestVE_ExitFailover resolves the exit through the endpoints failing one after the other,
+// testdata/geoip.mmdb maps 203.0.113.0/24 to IR, AS64500 "Test Net"
+func TestVE_ExitFailover(t *testing.T) {
+	h := har.New()
+	h.Log.Entries = append(
+		h.Log.Entries,
+		echoEntry(IPEndpointIpify.URL, 503, "unavailable"),
+		echoEntry(IPEndpointIcanhazip.URL, 200, "<html>blocked</html>"),
+		echoEntry(IPEndpointIpinfo.URL, 200, `{"ip":"203.0.113.7","country":"IR"}`),
+	)
+	proxy := proxstore.NewProxy[tls_client.HttpClient]("127.0.0.1", 8080, proxstore.ProtocolHttp)
+	proxy.Country = "DE"
+	proxy.SetHttpClient(har.NewClient(h, har.MatchLenient), "ve")
+
+	geoIP, err := OpenGeoIP("testdata/geoip.mmdb")
+	require.NoError(t, err)
+	defer geoIP.Close()
+
+	v := (&VE{proxy: proxy}).
+		SetGeoIP(geoIP).
+		SetIPResolver(NewEchoIPResolver(IPEndpointIpify, IPEndpointIcanhazip, IPEndpointIpinfo))
+	exit, err := v.Exit(context.Background())
+	assert.ErrorIs(t, err, proxstore.ErrExitCountryMismatch, "the proxy claims DE")
+	assert.Equal(t, "203.0.113.7", exit.IP)
+	assert.Equal(t, IPEndpointIpinfo.URL, exit.Source)
+	assert.Equal(t, "IR", exit.Country)
+	assert.EqualValues(t, 64500, exit.ASN)
+	assert.Equal(t, "Test Net", exit.Organization)
+
+	observed, ok := proxy.ObservedExit()
+	require.True(t, ok)
+	assert.Equal(t, exit, observed)
+
+	v.SetIPResolver(NewEchoIPResolver(IPEndpointIcanhazip))
+	_, err = v.IP(context.Background())
+	assert.ErrorIs(t, err, ErrIPNotResolved)
+	assert.ErrorContains(t, err, ErrInvalidIP.Error())
+}
@@ -0,0 +1,323 @@
+package ve
+
+import (
+	"context"
+	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/proxstore"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by [Pool.Get] once the pool is closed
+var ErrPoolClosed = errors.New("session pool is closed")
+
+type PoolOptions struct {
+	// MaxSize is the maximum number of sessions, idle or in use, defaults to 10
+	MaxSize int
+	// MaxIdleTime is how long a session may stay idle before it's discarded, 0 means no limit
+	MaxIdleTime time.Duration
+	// MaxUses is the number of times a session is handed out before it's discarded, 0 means no limit
+	MaxUses int
+	// MinProxyScore is the minimum health score of the proxies leased for the new sessions, see [proxstore.ProxStore.NextHealthy]
+	MinProxyScore float64
+	// New builds a session on the leased proxy, defaults to [New]
+	New func(proxy *proxstore.Proxy[tls_client.HttpClient]) *VE
+	// Warmup warms a new session up before it's handed out, e.g., by loading the index, optional
+	Warmup func(ctx context.Context, ve *VE) error
+	// IsFatal determines whether the error of a session discards it, defaults to the errors the proxy is to blame for
+	IsFatal func(err error) bool
+}
+
+// PoolStats is a snapshot of the metrics of a pool
+type PoolStats struct {
+	// Size is the number of sessions, Idle + InUse
+	Size    int `json:"size"`
+	Idle    int `json:"idle"`
+	InUse   int `json:"in_use"`
+	Waiting int `json:"waiting"`
+	// Acquired is the number of sessions handed out, WaitTime is the total time Get waited for them
+	Acquired uint64        `json:"acquired"`
+	WaitTime time.Duration `json:"wait_time_ns"`
+	// Created, Discarded and Expired are the churn of the sessions, Expired ones are also counted as Discarded
+	Created   uint64 `json:"created"`
+	Discarded uint64 `json:"discarded"`
+	Expired   uint64 `json:"expired"`
+}
+
+// AvgWaitTime returns the average time waited for a session
+func (s PoolStats) AvgWaitTime() time.Duration {
+	if s.Acquired == 0 {
+		return 0
+	}
+	return s.WaitTime / time.Duration(s.Acquired)
+}
+
+// Session is a session handed out by a [Pool], it must be released via [Session.Release]
+//
+// Every [Pool.Get] hands out its own Session, even for a session which was handed out before.
+type Session struct {
+	*VE
+	pool     *Pool
+	pooled   *pooledSession
+	released bool
+}
+
+// pooledSession is a session kept by a [Pool] across its uses
+type pooledSession struct {
+	ve *VE
+	// proxy is the proxy leased for the session, nil without a proxy store
+	proxy    *proxstore.Proxy[tls_client.HttpClient]
+	uses     int
+	lastUsed time.Time
+}
+
+// Pool hands out warmed up sessions, each on its own proxy lease, and rebuilds the worn out ones
+//
+// The sessions only share a proxy when there are fewer proxies than sessions, e.g., a single rotating gateway, and
+// a proxy is released from its provider once its last session is discarded, so the next lease gets a fresh exit.
+type Pool struct {
+	options PoolOptions
+	ps      *proxstore.ProxStore[tls_client.HttpClient]
+	// slots limits the sessions to MaxSize, a slot is held by every session in use
+	slots chan struct{}
+	mu    sync.Mutex
+	idle  []*pooledSession
+	// leases are the number of sessions holding each proxy
+	leases map[*proxstore.Proxy[tls_client.HttpClient]]int
+	closed bool
+	stats  PoolStats
+}
+
+// NewPool creates a pool of the sessions on the proxies of the proxy store
+func NewPool(cfg *config.Config, proxyStore *proxstore.ProxStore[tls_client.HttpClient], options PoolOptions) *Pool {
+	if options.MaxSize <= 0 {
+		options.MaxSize = 10
+	}
+	if options.New == nil {
+		options.New = func(proxy *proxstore.Proxy[tls_client.HttpClient]) *VE {
+			return New(cfg, proxyStore, proxy)
+		}
+	}
+	if options.IsFatal == nil {
+		options.IsFatal = func(err error) bool {
+			var pf proxstore.ProxyFaulter
+			return errors.As(err, &pf) && pf.ProxyFault()
+		}
+	}
+	return &Pool{
+		options: options,
+		ps:      proxyStore,
+		slots:   make(chan struct{}, options.MaxSize),
+		leases:  map[*proxstore.Proxy[tls_client.HttpClient]]int{},
+	}
+}
+
+// Get returns an idle session, or builds a new one, waiting for one to be released when the pool is full
+func (p *Pool) Get(ctx context.Context) (*Session, error) {
+	start := time.Now()
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	p.stats.Waiting++
+	p.mu.Unlock()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.stats.Waiting--
+		p.mu.Unlock()
+		return nil, errors.Wrap(ctx.Err(), "failed to wait for a session")
+	}
+
+	p.mu.Lock()
+	p.stats.Waiting--
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, ErrPoolClosed
+	}
+	p.stats.WaitTime += time.Since(start)
+	pooled, expired := p.popIdle()
+	if pooled != nil {
+		p.stats.Acquired++
+		p.stats.InUse++
+		pooled.uses++
+	}
+	p.mu.Unlock()
+	p.discard(nil, expired...)
+	if pooled != nil {
+		return &Session{VE: pooled.ve, pool: p, pooled: pooled}, nil
+	}
+
+	pooled, err := p.newSession(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	p.mu.Lock()
+	p.stats.Acquired++
+	p.stats.Created++
+	p.stats.InUse++
+	p.mu.Unlock()
+	return &Session{VE: pooled.ve, pool: p, pooled: pooled}, nil
+}
+
+// popIdle returns the most recently used idle session that's not expired, along with the expired ones to be
+// discarded, p.mu must be held
+func (p *Pool) popIdle() (*pooledSession, []*pooledSession) {
+	expired := p.pruneIdle()
+	if len(p.idle) == 0 {
+		return nil, expired
+	}
+	s := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	p.stats.Idle--
+	return s, expired
+}
+
+// pruneIdle removes the sessions idle for longer than MaxIdleTime, returning them to be discarded,
+// p.mu must be held
+func (p *Pool) pruneIdle() []*pooledSession {
+	if p.options.MaxIdleTime <= 0 {
+		return nil
+	}
+	var expired []*pooledSession
+	kept := p.idle[:0]
+	for _, s := range p.idle {
+		if time.Since(s.lastUsed) > p.options.MaxIdleTime {
+			p.stats.Idle--
+			p.stats.Discarded++
+			p.stats.Expired++
+			expired = append(expired, s)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	clear(p.idle[len(kept):])
+	p.idle = kept
+	return expired
+}
+
+// newSession builds and warms up a session on a fresh proxy lease
+func (p *Pool) newSession(ctx context.Context) (*pooledSession, error) {
+	proxy := p.leaseProxy()
+	s := &pooledSession{ve: p.options.New(proxy), proxy: proxy, uses: 1}
+	if p.options.Warmup != nil {
+		if err := p.options.Warmup(ctx, s.ve); err != nil {
+			p.mu.Lock()
+			p.stats.Discarded++
+			p.mu.Unlock()
+			p.discard(err, s)
+			return nil, errors.Wrap(err, "failed to warm session up")
+		}
+	}
+	return s, nil
+}
+
+// leaseProxy leases the next healthy proxy that no other session holds, sharing one only when they are all held
+func (p *Pool) leaseProxy() *proxstore.Proxy[tls_client.HttpClient] {
+	if p.ps == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var proxy *proxstore.Proxy[tls_client.HttpClient]
+	for range max(p.ps.Count(), 1) {
+		candidate := p.ps.NextHealthy(p.options.MinProxyScore)
+		if candidate == nil {
+			break
+		}
+		if proxy == nil || p.leases[candidate] < p.leases[proxy] {
+			proxy = candidate
+		}
+		if p.leases[proxy] == 0 {
+			break
+		}
+	}
+	if proxy != nil {
+		p.leases[proxy]++
+	}
+	return proxy
+}
+
+// discard deletes the persisted cookie jars of the discarded sessions, as no other session picks them up, and
+// returns their proxy leases, err is the outcome of their last use
+//
+// A proxy is released from its provider once no session holds it anymore, or right away when it's to blame for err.
+func (p *Pool) discard(err error, sessions ...*pooledSession) {
+	fatal := err != nil && p.options.IsFatal(err)
+	for _, s := range sessions {
+		_ = s.ve.DeleteCookieJar(context.Background())
+		if s.proxy == nil {
+			continue
+		}
+		p.mu.Lock()
+		p.leases[s.proxy]--
+		last := p.leases[s.proxy] <= 0
+		if last {
+			delete(p.leases, s.proxy)
+		}
+		p.mu.Unlock()
+		if last || fatal {
+			_, _ = p.ps.ReleaseProxy(s.proxy)
+		}
+	}
+}
+
+// Release returns the session to its pool, err is the outcome of its last use
+//
+// The session is discarded when err is fatal or it has been used MaxUses times. Releasing it again is a no-op,
+// even once the session was handed out again by another Get.
+func (s *Session) Release(err error) {
+	p := s.pool
+	p.mu.Lock()
+	if s.released {
+		p.mu.Unlock()
+		return
+	}
+	s.released = true
+	pooled := s.pooled
+	pooled.lastUsed = time.Now()
+	p.stats.InUse--
+	fatal := err != nil && p.options.IsFatal(err)
+	discarded := p.closed || fatal || (p.options.MaxUses > 0 && pooled.uses >= p.options.MaxUses)
+	if discarded {
+		p.stats.Discarded++
+	} else {
+		p.idle = append(p.idle, pooled)
+		p.stats.Idle++
+	}
+	p.mu.Unlock()
+	<-p.slots
+	if discarded {
+		p.discard(err, pooled)
+	}
+}
+
+// Stats returns the metrics of the pool
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	expired := p.pruneIdle()
+	stats := p.stats
+	p.mu.Unlock()
+	p.discard(nil, expired...)
+	stats.Size = stats.Idle + stats.InUse
+	return stats
+}
+
+// Close discards the idle sessions, the sessions in use are discarded once released
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.stats.Discarded += uint64(len(idle))
+	p.stats.Idle = 0
+	p.idle = nil
+	p.mu.Unlock()
+	p.discard(nil, idle...)
+}
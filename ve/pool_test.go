@@ -0,0 +1,162 @@
+package ve
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	ps := proxstore.NewWithOptions[tls_client.HttpClient](&proxstore.Options{}, nil)
+	require.NoError(t, ps.LoadLine("http://127.0.0.1:8080"))
+	require.NoError(t, ps.LoadLine("http://127.0.0.2:8080"))
+
+	warmups := 0
+	pool := NewPool(
+		nil, ps, PoolOptions{
+			MaxSize: 1,
+			MaxUses: 2,
+			New: func(proxy *proxstore.Proxy[tls_client.HttpClient]) *VE {
+				return &VE{ps: ps, proxy: proxy}
+			},
+			Warmup: func(ctx context.Context, ve *VE) error {
+				warmups++
+				return nil
+			},
+		},
+	)
+	ctx := context.Background()
+
+	first, err := pool.Get(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, first.proxy)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.Get(timeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the pool is full")
+
+	first.Release(nil)
+	first.Release(nil)
+	again, err := pool.Get(ctx)
+	require.NoError(t, err)
+	assert.Same(t, first.VE, again.VE)
+	// A late release of the previous holder doesn't release the session of the new one
+	first.Release(nil)
+	assert.Equal(t, 1, pool.Stats().InUse)
+	again.Release(nil)
+
+	third, err := pool.Get(ctx)
+	require.NoError(t, err)
+	assert.NotSame(t, first.VE, third.VE, "a session used MaxUses times is rebuilt")
+	third.Release(&ProxyError{RequestError: RequestError{ProxyID: third.proxy.ID()}})
+
+	stats := pool.Stats()
+	assert.Equal(t, PoolStats{Acquired: 3, WaitTime: stats.WaitTime, Created: 2, Discarded: 2}, stats)
+	assert.Equal(t, 2, warmups)
+	assert.Equal(t, stats.WaitTime/3, stats.AvgWaitTime())
+
+	pool.Close()
+	_, err = pool.Get(ctx)
+	assert.ErrorIs(t, err, ErrPoolClosed)
+}
+
+func TestPoolMaxIdleTime(t *testing.T) {
+	pool := NewPool(
+		nil, nil, PoolOptions{
+			MaxIdleTime: time.Millisecond,
+			New: func(proxy *proxstore.Proxy[tls_client.HttpClient]) *VE {
+				return &VE{}
+			},
+		},
+	)
+	s, err := pool.Get(context.Background())
+	require.NoError(t, err)
+	s.Release(nil)
+	assert.Equal(t, 1, pool.Stats().Idle)
+
+	time.Sleep(5 * time.Millisecond)
+	stats := pool.Stats()
+	assert.Equal(t, 0, stats.Size)
+	assert.EqualValues(t, 1, stats.Expired)
+}
+
+func TestPoolDeletesCookieJars(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileCookieJarStore(t.TempDir())
+	require.NoError(t, err)
+	sessions, err := NewCookieJarSessions(CookieJarSessionsOptions{Store: store})
+	require.NoError(t, err)
+	defer sessions.Close(ctx)
+
+	id := 0
+	pool := NewPool(
+		nil, nil, PoolOptions{
+			New: func(proxy *proxstore.Proxy[tls_client.HttpClient]) *VE {
+				id++
+				v := &VE{}
+				require.NoError(t, v.SetSessionID(ctx, sessions, fmt.Sprintf("pool:%d", id)))
+				return v
+			},
+		},
+	)
+	first, err := pool.Get(ctx)
+	require.NoError(t, err)
+	second, err := pool.Get(ctx)
+	require.NoError(t, err)
+	assert.NotSame(t, first.CookieJar(), second.CookieJar(), "the sessions must not share their cookies")
+
+	require.NoError(t, first.SaveCookieJar(ctx))
+	first.Release(&ProxyError{})
+	_, err = store.Load(ctx, first.SessionID())
+	assert.ErrorIs(t, err, ErrCookieJarNotFound, "the burnt cookies of a discarded session must be deleted")
+	second.Release(nil)
+	assert.Equal(t, 1, sessions.Len())
+}
+
+func TestPoolProxyLeases(t *testing.T) {
+	ps := proxstore.NewWithOptions[tls_client.HttpClient](&proxstore.Options{}, nil)
+	require.NoError(t, ps.LoadLine("http://127.0.0.1:8080"))
+	require.NoError(t, ps.LoadLine("http://127.0.0.2:8080"))
+	newPool := func(ps *proxstore.ProxStore[tls_client.HttpClient]) *Pool {
+		return NewPool(
+			nil, ps, PoolOptions{
+				MaxSize: 2,
+				MaxUses: 1,
+				New: func(proxy *proxstore.Proxy[tls_client.HttpClient]) *VE {
+					return &VE{ps: ps, proxy: proxy}
+				},
+			},
+		)
+	}
+	ctx := context.Background()
+
+	pool := newPool(ps)
+	first, err := pool.Get(ctx)
+	require.NoError(t, err)
+	second, err := pool.Get(ctx)
+	require.NoError(t, err)
+	assert.NotSame(t, first.proxy, second.proxy, "the sessions must not share a proxy while there are free ones")
+	first.Release(nil)
+	assert.Equal(t, 1, first.proxy.RotationStats().Releases, "the proxy of a discarded session is released")
+	assert.Zero(t, second.proxy.RotationStats().Releases)
+	second.Release(nil)
+
+	gateway := proxstore.NewWithOptions[tls_client.HttpClient](&proxstore.Options{}, nil)
+	require.NoError(t, gateway.LoadLine("http://127.0.0.3:8080"))
+	pool = newPool(gateway)
+	first, err = pool.Get(ctx)
+	require.NoError(t, err)
+	second, err = pool.Get(ctx)
+	require.NoError(t, err)
+	assert.Same(t, first.proxy, second.proxy)
+	first.Release(nil)
+	assert.Zero(t, first.proxy.RotationStats().Releases, "a proxy still held by another session isn't released")
+	second.Release(nil)
+	assert.Equal(t, 1, second.proxy.RotationStats().Releases)
+}
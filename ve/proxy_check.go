@@ -0,0 +1,261 @@
+package ve
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/Dissociable/Couploan/proxstore"
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/conc/pool"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnexpectedResponse is returned when the target responded, but not with the expected page
+var ErrUnexpectedResponse = errors.New("unexpected response")
+
+// ProxyCheckStatus is the outcome of a proxy check
+type ProxyCheckStatus string
+
+const (
+	ProxyCheckOK     ProxyCheckStatus = "ok"
+	ProxyCheckFailed ProxyCheckStatus = "failed"
+)
+
+// Error classes of the failed checks, see [ErrorClass]
+const (
+	ErrorClassProxy       = "proxy"
+	ErrorClassTimeout     = "timeout"
+	ErrorClassTLS         = "tls"
+	ErrorClassStatus      = "status"
+	ErrorClassCircuitOpen = "circuit_open"
+	ErrorClassResponse    = "response"
+	ErrorClassExitCountry = "exit_country"
+	ErrorClassCanceled    = "canceled"
+	ErrorClassOther       = "other"
+)
+
+type ProxyCheckOptions struct {
+	// Profile is the target the proxies are checked against, defaults to TargetProfileVE
+	Profile *TargetProfile
+	// Target is the url requested through the proxies, defaults to the health check url of the Profile
+	Target string
+	// Timeout is the timeout of checking a single proxy, defaults to 30s
+	Timeout time.Duration
+	// Concurrency is the number of proxies checked at once by [CheckProxies], defaults to 10
+	Concurrency int
+	// Validate validates the response of the target, defaults to expecting the markers of the Profile
+	Validate func(resp *http.Response, body string) error
+	// ResolveExit resolves the exit ip of the working proxies via IPResolver
+	ResolveExit bool
+	// IPResolver defaults to an [EchoIPResolver] over all the known endpoints
+	IPResolver IPResolver
+	// GeoIP enriches the exits with their country, so the proxies claiming a Country are verified to exit from it,
+	// optional
+	GeoIP *GeoIP
+	// NewClient creates the http client of the proxy, defaults to a Chrome client through the proxy
+	NewClient func(proxy *proxstore.Proxy[tls_client.HttpClient], timeout time.Duration) (tls_client.HttpClient, error)
+}
+
+// ProxyCheckResult is the outcome of checking a single proxy
+type ProxyCheckResult struct {
+	Proxy       *proxstore.Proxy[tls_client.HttpClient] `json:"-"`
+	ProxyID     string                                  `json:"proxy"`
+	Status      ProxyCheckStatus                        `json:"status"`
+	StatusCode  int                                     `json:"status_code,omitempty"`
+	Latency     time.Duration                           `json:"-"`
+	LatencyMS   int64                                   `json:"latency_ms"`
+	ExitIP      string                                  `json:"exit_ip,omitempty"`
+	ExitCountry string                                  `json:"exit_country,omitempty"`
+	ErrorClass  string                                  `json:"error_class,omitempty"`
+	Error       string                                  `json:"error,omitempty"`
+	Err         error                                   `json:"-"`
+}
+
+func (o *ProxyCheckOptions) withDefaults() ProxyCheckOptions {
+	var options ProxyCheckOptions
+	if o != nil {
+		options = *o
+	}
+	if options.Profile == nil {
+		options.Profile = TargetProfileVE
+	}
+	if options.Target == "" {
+		options.Target = options.Profile.HealthCheckURL()
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 30 * time.Second
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 10
+	}
+	if options.Validate == nil {
+		options.Validate = options.Profile.Validate
+	}
+	if options.NewClient == nil {
+		options.NewClient = newProxyCheckClient
+	}
+	return options
+}
+
+func newProxyCheckClient(
+	proxy *proxstore.Proxy[tls_client.HttpClient], timeout time.Duration,
+) (tls_client.HttpClient, error) {
+	opts := []tls_client.HttpClientOption{
+		tls_client.WithTimeoutSeconds(int(timeout.Seconds())),
+		tls_client.WithNotFollowRedirects(),
+		tls_client.WithClientProfile(profiles.Chrome_124),
+	}
+	if !proxy.IsEmpty() && !proxy.IsDirect() {
+		opts = append(opts, tls_client.WithProxyUrl(proxy.String()))
+	}
+	return tls_client.NewHttpClient(tls_client.NewNoopLogger(), opts...)
+}
+
+// CheckProxy checks if the proxy is valid and working,
+// if proxy been working and good http response returned, it returns nil
+func CheckProxy(ctx context.Context, proxy *proxstore.Proxy[tls_client.HttpClient]) (err error) {
+	if proxy == nil {
+		err = errors.New("no proxy is set")
+		return
+	}
+	return CheckProxyWithOptions(ctx, proxy, nil).Err
+}
+
+// CheckProxyWithOptions requests the target through the proxy, and resolves its exit ip if enabled
+func CheckProxyWithOptions(
+	ctx context.Context, proxy *proxstore.Proxy[tls_client.HttpClient], options *ProxyCheckOptions,
+) (result ProxyCheckResult) {
+	opts := options.withDefaults()
+	result = ProxyCheckResult{Proxy: proxy, ProxyID: proxy.ID(), Status: ProxyCheckFailed}
+	defer func() {
+		result.LatencyMS = result.Latency.Milliseconds()
+		if result.Err != nil {
+			result.ErrorClass = ErrorClass(result.Err)
+			result.Error = result.Err.Error()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	c, err := opts.NewClient(proxy, opts.Timeout)
+	if err != nil {
+		result.Err = errors.Wrap(err, "failed to create http client")
+		return
+	}
+
+	start := time.Now()
+	resp, body, err := NewRequest[any](nil, "GET", opts.Target).
+		SetContext(ctx).
+		SetHeaders(opts.Profile.DefaultHeaders()).
+		SetClient(c).
+		SetProxy(proxy).
+		Do()
+	result.Latency = time.Since(start)
+	if resp != nil {
+		result.StatusCode = resp.StatusCode
+	}
+	if err != nil {
+		result.Err = errors.Wrap(err, "failed to check proxy")
+		return
+	}
+	if err = opts.Validate(resp, body); err != nil {
+		result.Err = errors.Wrap(err, "proxy is not working")
+		return
+	}
+
+	if opts.ResolveExit {
+		if !proxy.HasHttpClient() {
+			proxy.SetHttpClient(c, "ve")
+		}
+		exit, err := (&VE{proxy: proxy, ipResolver: opts.IPResolver, geoIP: opts.GeoIP}).Exit(ctx)
+		result.ExitIP, result.ExitCountry = exit.IP, exit.Country
+		if err != nil {
+			result.Err = err
+			return
+		}
+	}
+	result.Status = ProxyCheckOK
+	return
+}
+
+// CheckProxies checks the proxies concurrently, the results are in the order of the proxies
+func CheckProxies(
+	ctx context.Context, proxies []*proxstore.Proxy[tls_client.HttpClient], options *ProxyCheckOptions,
+) []ProxyCheckResult {
+	opts := options.withDefaults()
+	results := make([]ProxyCheckResult, len(proxies))
+	p := pool.New().WithMaxGoroutines(opts.Concurrency)
+	for i, proxy := range proxies {
+		p.Go(
+			func() {
+				results[i] = CheckProxyWithOptions(ctx, proxy, &opts)
+			},
+		)
+	}
+	p.Wait()
+	return results
+}
+
+// ErrorClass returns the class of the error of a failed request, one of the ErrorClass constants
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrCircuitOpen):
+		return ErrorClassCircuitOpen
+	case errors.Is(err, ErrProxy):
+		return ErrorClassProxy
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.Is(err, ErrTLS):
+		return ErrorClassTLS
+	case errors.Is(err, ErrStatus):
+		return ErrorClassStatus
+	case errors.Is(err, ErrUnexpectedResponse), errors.Is(err, ErrIPNotResolved):
+		return ErrorClassResponse
+	case errors.Is(err, proxstore.ErrExitCountryMismatch):
+		return ErrorClassExitCountry
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	}
+	return ErrorClassOther
+}
+
+// WriteProxyCheckReport writes the results to w, format is either "json" or "csv"
+func WriteProxyCheckReport(w io.Writer, format string, results []ProxyCheckResult) error {
+	switch strings.ToLower(format) {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if results == nil {
+			results = []ProxyCheckResult{}
+		}
+		return errors.Wrap(enc.Encode(results), "failed to write json report")
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write(
+			[]string{"proxy", "status", "status_code", "latency_ms", "exit_ip", "exit_country", "error_class", "error"},
+		)
+		for _, result := range results {
+			statusCode := ""
+			if result.StatusCode > 0 {
+				statusCode = strconv.Itoa(result.StatusCode)
+			}
+			_ = cw.Write(
+				[]string{
+					result.ProxyID, string(result.Status), statusCode, strconv.FormatInt(result.LatencyMS, 10),
+					result.ExitIP, result.ExitCountry, result.ErrorClass, result.Error,
+				},
+			)
+		}
+		cw.Flush()
+		return errors.Wrap(cw.Error(), "failed to write csv report")
+	}
+	return errors.Errorf("unknown report format %q", format)
+}
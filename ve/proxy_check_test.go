@@ -0,0 +1,99 @@
+package ve
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve/har"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckProxies(t *testing.T) {
+	const target = "https://example.com/"
+	entries := map[string][]*har.Entry{
+		"127.0.0.1": {
+			echoEntry(target, 200, `<script>window["bobcmn"] = 1</script>`),
+			echoEntry(IPEndpointIpify.URL, 200, "203.0.113.7"),
+		},
+		"127.0.0.2": {echoEntry(target, 503, "unavailable")},
+		"127.0.0.3": {echoEntry(target, 200, "<html>blocked</html>")},
+		"127.0.0.4": {
+			echoEntry(target, 200, `<script>window["bobcmn"] = 1</script>`),
+			echoEntry(IPEndpointIpify.URL, 200, "203.0.113.8"),
+		},
+	}
+	var proxies []*proxstore.Proxy[tls_client.HttpClient]
+	for _, host := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.3", "127.0.0.4"} {
+		proxies = append(proxies, proxstore.NewProxy[tls_client.HttpClient](host, 8080, proxstore.ProtocolHttp))
+	}
+	// testdata/geoip.mmdb maps 203.0.113.0/24 to IR
+	proxies[0].Country = "IR"
+	proxies[3].Country = "DE"
+	geoIP, err := OpenGeoIP("testdata/geoip.mmdb")
+	require.NoError(t, err)
+	defer geoIP.Close()
+
+	results := CheckProxies(
+		context.Background(), proxies, &ProxyCheckOptions{
+			Target:      target,
+			Concurrency: 2,
+			ResolveExit: true,
+			IPResolver:  NewEchoIPResolver(IPEndpointIpify),
+			GeoIP:       geoIP,
+			NewClient: func(proxy *proxstore.Proxy[tls_client.HttpClient], _ time.Duration) (
+				tls_client.HttpClient, error,
+			) {
+				h := har.New()
+				h.Log.Entries = entries[proxy.Host]
+				return har.NewClient(h, har.MatchLenient), nil
+			},
+		},
+	)
+	require.Len(t, results, 4)
+
+	assert.Equal(t, ProxyCheckOK, results[0].Status)
+	assert.Equal(t, "http://127.0.0.1:8080", results[0].ProxyID)
+	assert.Equal(t, 200, results[0].StatusCode)
+	assert.Equal(t, "203.0.113.7", results[0].ExitIP)
+	assert.NoError(t, results[0].Err)
+
+	assert.Equal(t, ProxyCheckFailed, results[1].Status)
+	assert.Equal(t, 503, results[1].StatusCode)
+	assert.Equal(t, ErrorClassStatus, results[1].ErrorClass)
+
+	assert.Equal(t, ProxyCheckFailed, results[2].Status)
+	assert.Equal(t, ErrorClassResponse, results[2].ErrorClass)
+	assert.ErrorIs(t, results[2].Err, ErrUnexpectedResponse)
+
+	assert.Equal(t, ProxyCheckFailed, results[3].Status, "the proxy claims DE but exits from IR")
+	assert.Equal(t, ErrorClassExitCountry, results[3].ErrorClass)
+	assert.Equal(t, "IR", results[3].ExitCountry)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteProxyCheckReport(&buf, "csv", results))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+	assert.Equal(t, []string{"http://127.0.0.1:8080", "ok", "200"}, records[1][:3])
+	assert.Equal(t, []string{"203.0.113.7", "IR"}, records[1][4:6])
+	assert.Equal(t, "status", records[2][6])
+
+	assert.Error(t, WriteProxyCheckReport(&buf, "xml", results))
+}
+
+func TestNewProxyCheckClient(t *testing.T) {
+	direct, err := newProxyCheckClient(proxstore.NewProxy[tls_client.HttpClient]("", 0, proxstore.ProtocolDirect), time.Second)
+	require.NoError(t, err)
+	assert.Empty(t, direct.GetProxy(), "a direct check must not go through a proxy")
+
+	proxy := proxstore.NewProxy[tls_client.HttpClient]("127.0.0.1", 8080, proxstore.ProtocolHttp)
+	client, err := newProxyCheckClient(proxy, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, proxy.String(), client.GetProxy())
+}
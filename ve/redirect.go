@@ -0,0 +1,134 @@
+package ve
+
+import (
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrTooManyRedirects is returned by [Requester.Do] when the redirects exceed the max hops
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrUseLastResponse can be returned by a RedirectPolicy to stop following and return the redirect response
+	ErrUseLastResponse = errors.New("use last response")
+)
+
+// RedirectPolicy decides whether the redirect to next is followed, via being the requests sent so far, oldest first
+//
+// Returning ErrUseLastResponse stops following and returns the redirect response, any other error is returned by Do()
+type RedirectPolicy func(next *http.Request, via []*http.Request) error
+
+// RedirectSameHost is a RedirectPolicy following only the redirects to the host of the first request
+func RedirectSameHost(next *http.Request, via []*http.Request) error {
+	if next.URL.Host != via[0].URL.Host {
+		return ErrUseLastResponse
+	}
+	return nil
+}
+
+// RedirectHop is a redirect response followed by [Requester.Do]
+type RedirectHop struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// Location is the resolved url the request was redirected to
+	Location string
+}
+
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectMethod returns the method of the redirected request and whether it keeps the body, per RFC 9110
+//
+// 301 and 302 turn a POST into a GET, 303 turns everything but HEAD into a GET, 307 and 308 keep the method
+func redirectMethod(method string, statusCode int) (string, bool) {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound:
+		if method == http.MethodPost {
+			return http.MethodGet, false
+		}
+	case http.StatusSeeOther:
+		if method != http.MethodHead {
+			return http.MethodGet, false
+		}
+	}
+	return method, true
+}
+
+// send sends the request via do, following the redirects if enabled and recording them
+func (r *Requester[C]) send(do func(req *http.Request) (*http.Response, string, error), req *http.Request) (
+	resp *http.Response, respBody string, err error,
+) {
+	r.redirects = nil
+	via := []*http.Request{req}
+	body := r.body
+	for {
+		resp, respBody, err = do(req)
+		if err != nil || r.maxRedirects <= 0 || resp == nil || !isRedirect(resp.StatusCode) {
+			return
+		}
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return
+		}
+		u, errParse := req.URL.Parse(location)
+		if errParse != nil {
+			err = errors.Wrap(errParse, "failed to parse redirect location")
+			return
+		}
+		r.redirects = append(
+			r.redirects, RedirectHop{
+				Method:     req.Method,
+				URL:        req.URL.String(),
+				StatusCode: resp.StatusCode,
+				Location:   u.String(),
+			},
+		)
+		if len(r.redirects) > r.maxRedirects {
+			err = errors.Wrapf(ErrTooManyRedirects, "stopped after %d redirects", r.maxRedirects)
+			return
+		}
+
+		method, keepBody := redirectMethod(req.Method, resp.StatusCode)
+		headers := req.Header.Clone()
+		if !keepBody {
+			body = nil
+			headers.Del("Content-Type")
+			headers.Del("Content-Length")
+		}
+		next, errNext := http.NewRequest(method, u.String(), body.Reader())
+		if errNext != nil {
+			err = errors.Wrap(errNext, "failed to create redirect request")
+			return
+		}
+		// The credentials of the first host must not leak to the others, the cookies are set by the jar
+		if u.Host != via[0].URL.Host {
+			headers.Del("Authorization")
+			headers.Del("Cookie")
+		}
+		// The Host follows the redirect to another host, an overridden one is kept on the same host
+		if u.Host != req.URL.Host {
+			headers.Set("Host", u.Host)
+		} else if host := headers.Get("Host"); host != "" {
+			next.Host = host
+		}
+		next.Header = headers
+
+		if r.redirectPolicy != nil {
+			if errPolicy := r.redirectPolicy(next, via); errPolicy != nil {
+				if errors.Is(errPolicy, ErrUseLastResponse) {
+					return
+				}
+				err = errors.Wrap(errPolicy, "redirect policy rejected the redirect")
+				return
+			}
+		}
+		req = next
+		via = append(via, req)
+	}
+}
@@ -0,0 +1,80 @@
+package ve
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve/har"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func redirectEntry(method, link string, status int, headers ...har.NameValue) *har.Entry {
+	e := &har.Entry{
+		Request:  har.Request{Method: method, URL: link},
+		Response: har.Response{Status: status, HTTPVersion: "HTTP/1.1", Headers: headers},
+	}
+	if method == "POST" {
+		e.Request.PostData = &har.PostData{Text: "user=1"}
+	}
+	return e
+}
+
+func newRedirectRequester(t *testing.T, entries ...*har.Entry) (*Requester[any], *har.Client, *CookieJar) {
+	h := har.New()
+	h.Log.Entries = entries
+	client := har.NewClient(h, har.MatchStrict)
+	cj, err := NewCookieJar(&CookieJarOptions{Options: nil})
+	require.NoError(t, err)
+	r := NewRequest[any](nil, "POST", "https://ve.cbi.ir/app/login").
+		SetClient(client).
+		SetCookieJar(cj).
+		SetProxy(proxstore.NewProxy[tls_client.HttpClient]("", 0, proxstore.ProtocolDirect)).
+		SetFormBody(url.Values{"user": {"1"}})
+	return r, client, cj
+}
+
+func TestRequesterFollowRedirects(t *testing.T) {
+	r, client, cj := newRedirectRequester(
+		t,
+		redirectEntry(
+			"POST", "https://ve.cbi.ir/app/login", 302,
+			har.NameValue{Name: "Location", Value: "../home?step=1"},
+			har.NameValue{Name: "Set-Cookie", Value: "ASP.NET_SessionId=abc; Path=/"},
+		),
+		redirectEntry(
+			"GET", "https://ve.cbi.ir/home?step=1", 307,
+			har.NameValue{Name: "Location", Value: "https://ve.cbi.ir/DefaultVE.aspx"},
+		),
+		redirectEntry("GET", "https://ve.cbi.ir/DefaultVE.aspx", 200),
+	)
+
+	resp, _, err := r.SetFollowRedirects(5, nil).Do()
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 0, client.Remaining(), "the POST must be downgraded to GET after the 302")
+	assert.Equal(
+		t, []RedirectHop{
+			{Method: "POST", URL: "https://ve.cbi.ir/app/login", StatusCode: 302, Location: "https://ve.cbi.ir/home?step=1"},
+			{Method: "GET", URL: "https://ve.cbi.ir/home?step=1", StatusCode: 307, Location: "https://ve.cbi.ir/DefaultVE.aspx"},
+		}, r.GetRedirects(),
+	)
+	assert.Equal(t, map[string]string{"ASP.NET_SessionId": "abc"}, cookieValues(cj))
+}
+
+func TestRequesterRedirectLimits(t *testing.T) {
+	loop := redirectEntry("POST", "https://ve.cbi.ir/app/login", 307, har.NameValue{Name: "Location", Value: "/app/login"})
+	r, _, _ := newRedirectRequester(t, loop, loop, loop)
+	_, _, err := r.SetFollowRedirects(1, nil).Do()
+	assert.True(t, errors.Is(err, ErrTooManyRedirects))
+
+	r, _, _ = newRedirectRequester(
+		t, redirectEntry("POST", "https://ve.cbi.ir/app/login", 301, har.NameValue{Name: "Location", Value: "https://example.com/"}),
+	)
+	resp, _, err := r.SetFollowRedirects(5, RedirectSameHost).Do()
+	require.NoError(t, err)
+	assert.Equal(t, 301, resp.StatusCode, "the redirect to another host must not be followed")
+}
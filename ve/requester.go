@@ -9,6 +9,7 @@ import (
 	_ "github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
 	"io"
+	"net/url"
 )
 
 type RequesterRetryCheck[C any] func(requester *Requester[C], resp *http.Response, respBody *string, err error) bool
@@ -34,7 +35,9 @@ type Requester[C any] struct {
 	link             string
 	proxy            *proxstore.Proxy[tls_client.HttpClient]
 	headers          http.Header
-	body             io.Reader
+	host             string
+	body             *util.RequestBody
+	bodyErr          error
 	cookieJar        *CookieJar
 	getCookieJarFunc func(requester *Requester[C]) (*CookieJar, error)
 	retry            bool
@@ -42,6 +45,11 @@ type Requester[C any] struct {
 	retries          int
 	retryCheck       func(requester *Requester[C], resp *http.Response, respBody *string, err error) bool
 	afterResponse    func(requester *Requester[C], resp *http.Response, respBody *string, err error) error
+	interceptors     []util.Interceptor
+	circuitBreaker   *CircuitBreaker
+	maxRedirects     int
+	redirectPolicy   RedirectPolicy
+	redirects        []RedirectHop
 }
 
 func NewRequest[C any](base C, method string, link string) *Requester[C] {
@@ -112,11 +120,39 @@ func (r *Requester[C]) SetHeaders(headers http.Header) *Requester[C] {
 	return r
 }
 
+// SetHost overrides the Host of the request, which is otherwise derived from its url
+func (r *Requester[C]) SetHost(host string) *Requester[C] {
+	r.host = host
+	return r
+}
+
 // SetBody sets the body of the request
 //
-// NOTE: DO NOT USE io.NopCloser(...)
+// The body is read into memory, so it can be sent again on retries
 func (r *Requester[C]) SetBody(body io.Reader) *Requester[C] {
-	r.body = io.NopCloser(body)
+	r.body, r.bodyErr = util.NewRawBody(body)
+	return r
+}
+
+// SetFormBody sets an url encoded form as the body and its Content-Type
+func (r *Requester[C]) SetFormBody(values url.Values) *Requester[C] {
+	r.body, r.bodyErr = util.NewFormBody(values), nil
+	return r
+}
+
+// SetJSONBody sets the json encoded v as the body and its Content-Type
+//
+// In case v can't be marshalled, the error will be returned by Do()
+func (r *Requester[C]) SetJSONBody(v any) *Requester[C] {
+	r.body, r.bodyErr = util.NewJSONBody(v)
+	return r
+}
+
+// SetMultipartBody sets a multipart/form-data body of the fields and files and its Content-Type
+//
+// In case the body can't be built, the error will be returned by Do()
+func (r *Requester[C]) SetMultipartBody(fields url.Values, files ...util.MultipartFile) *Requester[C] {
+	r.body, r.bodyErr = util.NewMultipartBody(fields, files...)
 	return r
 }
 
@@ -147,6 +183,32 @@ func (r *Requester[C]) SetAfterResponse(
 	return r
 }
 
+// AddInterceptor adds an interceptor that wraps sending the request to the http client
+//
+// Interceptors are called in the order they are added, the first one being the outermost
+func (r *Requester[C]) AddInterceptor(interceptor util.Interceptor) *Requester[C] {
+	r.interceptors = append(r.interceptors, interceptor)
+	return r
+}
+
+// SetCircuitBreaker sets the circuit breaker guarding the host of the request
+//
+// While the circuit is open, Do() fails fast with a [CircuitOpenError] without sending the request
+func (r *Requester[C]) SetCircuitBreaker(circuitBreaker *CircuitBreaker) *Requester[C] {
+	r.circuitBreaker = circuitBreaker
+	return r
+}
+
+// SetFollowRedirects makes Do() follow up to maxHops redirects, the policy may be nil to follow all of them
+//
+// The relative locations are resolved against the redirecting url, the cookies are carried through the jar
+// and the method is downgraded to GET per RFC 9110, the followed redirects are returned by GetRedirects()
+func (r *Requester[C]) SetFollowRedirects(maxHops int, policy RedirectPolicy) *Requester[C] {
+	r.maxRedirects = maxHops
+	r.redirectPolicy = policy
+	return r
+}
+
 func (r *Requester[C]) SetContext(ctx context.Context) *Requester[C] {
 	r.ctx = ctx
 	return r
@@ -183,16 +245,29 @@ func (r *Requester[C]) GetHeaders() http.Header {
 }
 
 func (r *Requester[C]) GetBody() io.Reader {
-	return r.body
+	return r.body.Reader()
 }
 
 func (r *Requester[C]) GetContext() context.Context {
 	return r.ctx
 }
 
+// GetRedirects returns the redirects followed by the last attempt of Do(), oldest first
+func (r *Requester[C]) GetRedirects() []RedirectHop {
+	return r.redirects
+}
+
+// Do sends the request, retrying it if enabled
+//
+// The failures are returned as the request errors of this package, e.g., [TimeoutError] or [StatusError],
+// and every attempt is reported to the health of the proxy
 func (r *Requester[C]) Do() (
 	resp *http.Response, respBody string, err error,
 ) {
+	if r.bodyErr != nil {
+		err = errors.Wrap(r.bodyErr, "failed to build request body")
+		return
+	}
 	if r.getCookieJarFunc != nil && r.cookieJar == nil {
 		jar, err := r.getCookieJarFunc(r)
 		if err != nil {
@@ -208,17 +283,13 @@ func (r *Requester[C]) Do() (
 	if r.headers == nil {
 		r.headers = util.DefaultGetHeaders
 	}
-	var req *http.Request
-	if r.method == http.MethodGet {
-		req, err = util.BuildGetRequest(r.link, r.headers)
-		if err != nil {
-			return
-		}
-	} else if r.method == http.MethodPost {
-		req, err = util.BuildPostRequest(r.link, r.headers, r.body)
-		if err != nil {
-			return
-		}
+	req, err := util.BuildRequest(r.method, r.link, r.headers, r.body)
+	if err != nil {
+		return
+	}
+	if r.host != "" {
+		req.Host = r.host
+		req.Header.Set("Host", r.host)
 	}
 	var client tls_client.HttpClient
 	// If r.client is not nil and if proxy is not nil and proxy is not rotating, the re-use the client
@@ -243,7 +314,27 @@ func (r *Requester[C]) Do() (
 	if r.cookieJar != nil {
 		client.SetCookieJar(r.cookieJar)
 	}
-	resp, respBody, err = util.GetRequest(r.ctx, client, req)
+	if r.circuitBreaker != nil {
+		if allowed, retryIn := r.circuitBreaker.Allow(r.ctx, req.URL.Host); !allowed {
+			err = &CircuitOpenError{RequestError: r.requestError(), Host: req.URL.Host, RetryIn: retryIn}
+			return
+		}
+	}
+	do := util.ChainInterceptors(client.Do, r.interceptors...)
+	resp, respBody, err = r.send(
+		func(req *http.Request) (*http.Response, string, error) {
+			return util.DoRequest(r.ctx, do, req)
+		}, req,
+	)
+	err = r.typedError(resp, respBody, err)
+	if r.circuitBreaker != nil {
+		r.circuitBreaker.Report(r.ctx, req.URL.Host, err)
+	}
+	if err != nil {
+		r.proxy.ReportFailure(err)
+	} else {
+		r.proxy.ReportSuccess()
+	}
 	if r.afterResponse != nil {
 		errAfterResponse := r.afterResponse(r, resp, &respBody, err)
 		if errAfterResponse != nil {
@@ -261,13 +352,48 @@ func (r *Requester[C]) Do() (
 		r.retries++
 		return r.Do()
 	}
-	if err != nil {
-		err = errors.Wrap(err, "failed to get request")
-		return
-	}
 	return
 }
 
+// requestError returns the details of the current attempt for the request errors
+func (r *Requester[C]) requestError() RequestError {
+	base := RequestError{
+		Method:  r.method,
+		URL:     r.link,
+		ProxyID: r.proxy.ID(),
+		Attempt: r.retries + 1,
+	}
+	if r.proxy.IsDirect() {
+		base.ProxyID = ""
+	}
+	return base
+}
+
+// typedError turns the outcome of an attempt into one of the request errors, e.g., [ProxyError] or [StatusError]
+//
+// A 407 response is a ProxyError and 429 or 5xx responses are StatusError, the response is still returned with them
+func (r *Requester[C]) typedError(resp *http.Response, respBody string, err error) error {
+	base := r.requestError()
+	switch {
+	case err != nil:
+		return classifyError(base, err)
+	case resp == nil:
+		return nil
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		base.Err = errors.New(resp.Status)
+		return &ProxyError{RequestError: base, StatusCode: resp.StatusCode}
+	case IsStatusFailure(resp.StatusCode):
+		base.Err = errors.New(resp.Status)
+		return &StatusError{
+			RequestError: base,
+			StatusCode:   resp.StatusCode,
+			BodySnippet:  bodySnippet(respBody),
+			RetryAfter:   parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return nil
+}
+
 // ReSetProxy re-sets the proxy to the requester and gets the client again
 func (r *Requester[C]) ReSetProxy(proxy *proxstore.Proxy[tls_client.HttpClient]) (err error) {
 	r.SetProxy(proxy)
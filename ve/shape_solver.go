@@ -7,7 +7,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/tidwall/gjson"
 	"net/url"
-	"strings"
 )
 
 func (ve *VE) SolveShape(ctx context.Context) (err error) {
@@ -22,18 +21,18 @@ func (ve *VE) SolveShape(ctx context.Context) (err error) {
 
 	_, body, err := NewRequest(ve, "POST", ve.config.ShapeSolver.URL+"/api/v1/f5").
 		SetContext(ctx).
+		SetCircuitBreaker(ve.circuitBreaker).
 		SetClient(ve.shapeSolverClient).
 		SetProxy(ve.ps.Direct()).
 		SetRetry().
 		SetHeaders(
 			map[string][]string{
-				"Content-Type":    {"application/x-www-form-urlencoded"},
 				"Authorization":   {"Bearer " + ve.config.ShapeSolver.ApiKey},
 				"User-Agent":      {"Couploan"},
 				"Accept-Encoding": {"gzip, deflate, br"},
 			},
 		).
-		SetBody(strings.NewReader(rb.Encode())).
+		SetFormBody(rb).
 		SetMaxRetries(3).
 		Do()
 	if err != nil {
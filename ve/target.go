@@ -0,0 +1,81 @@
+package ve
+
+import (
+	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/ve/util"
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// TargetProfile describes the site the sessions talk to
+type TargetProfile struct {
+	// BaseURL is the scheme and host of the target, e.g., https://ve.cbi.ir
+	BaseURL string
+	// Headers are the default headers of the requests to the target, defaults to util.DefaultChromeHeaders
+	Headers http.Header
+	// HealthCheckPath is the page the proxies are checked against
+	HealthCheckPath string
+	// Markers are the strings of which at least one is expected on the health check page, none expects any page
+	Markers []string
+}
+
+// TargetProfileVE is the profile of ve.cbi.ir, the default target
+var TargetProfileVE = &TargetProfile{
+	BaseURL:         "https://ve.cbi.ir",
+	HealthCheckPath: "/DefaultVE.aspx",
+	Markers:         []string{`window["bobcmn"]`, "ازدواج"},
+}
+
+// NewTargetProfile creates the profile from the config, its headers are set on top of util.DefaultChromeHeaders
+func NewTargetProfile(cfg config.VETarget) *TargetProfile {
+	p := &TargetProfile{
+		BaseURL:         cfg.BaseURL,
+		HealthCheckPath: cfg.HealthCheckPath,
+		Markers:         cfg.Markers,
+	}
+	if len(cfg.Headers) > 0 {
+		p.Headers = util.DefaultChromeHeaders.Clone()
+		for key, value := range cfg.Headers {
+			p.Headers.Set(key, value)
+		}
+	}
+	return p
+}
+
+// URL returns the url of the path on the target
+func (p *TargetProfile) URL(path string) string {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return strings.TrimSuffix(p.BaseURL, "/") + path
+}
+
+// HealthCheckURL returns the url of the health check page
+func (p *TargetProfile) HealthCheckURL() string {
+	return p.URL(p.HealthCheckPath)
+}
+
+// DefaultHeaders returns the headers of the requests to the target
+func (p *TargetProfile) DefaultHeaders() http.Header {
+	if p.Headers == nil {
+		return util.DefaultChromeHeaders
+	}
+	return p.Headers
+}
+
+// Validate expects a successful response with at least one of the markers
+func (p *TargetProfile) Validate(resp *http.Response, body string) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return errors.Wrapf(ErrUnexpectedResponse, "bad response status code %d returned", resp.StatusCode)
+	}
+	for _, marker := range p.Markers {
+		if strings.Contains(body, marker) {
+			return nil
+		}
+	}
+	if len(p.Markers) > 0 {
+		return errors.Wrap(ErrUnexpectedResponse, "couldn't verify response body")
+	}
+	return nil
+}
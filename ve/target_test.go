@@ -0,0 +1,31 @@
+package ve
+
+import (
+	"testing"
+
+	"github.com/Dissociable/Couploan/config"
+	"github.com/Dissociable/Couploan/ve/util"
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetProfile(t *testing.T) {
+	p := NewTargetProfile(
+		config.VETarget{
+			BaseURL:         "https://example.com/",
+			Headers:         map[string]string{"referer": "https://example.com/"},
+			HealthCheckPath: "health",
+			Markers:         []string{"ready"},
+		},
+	)
+	assert.Equal(t, "https://example.com/health", p.HealthCheckURL())
+	assert.Equal(t, "https://example.com/", p.DefaultHeaders().Get("Referer"))
+	assert.Equal(t, util.UserAgentChrome, p.DefaultHeaders().Get("User-Agent"))
+	assert.Equal(t, "https://www.google.com/", util.DefaultChromeHeaders.Get("Referer"))
+
+	assert.NoError(t, p.Validate(&http.Response{StatusCode: 200}, "server is ready"))
+	assert.ErrorIs(t, p.Validate(&http.Response{StatusCode: 200}, "blocked"), ErrUnexpectedResponse)
+	assert.ErrorIs(t, p.Validate(&http.Response{StatusCode: 500}, "ready"), ErrUnexpectedResponse)
+	assert.NoError(t, (&TargetProfile{}).Validate(&http.Response{StatusCode: 204}, ""))
+	assert.Equal(t, "https://ve.cbi.ir/DefaultVE.aspx", TargetProfileVE.HealthCheckURL())
+}
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"bytes"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+const (
+	ContentTypeForm = "application/x-www-form-urlencoded"
+	ContentTypeJSON = "application/json"
+)
+
+// RequestBody holds a fully buffered request body, so it can be re-read for every retry
+type RequestBody struct {
+	// ContentType is the value of the Content-Type header, empty to keep the one from the headers
+	ContentType string
+	Data        []byte
+}
+
+// MultipartFile is a file part of a multipart body
+type MultipartFile struct {
+	FieldName   string
+	FileName    string
+	ContentType string // ContentType defaults to application/octet-stream
+	Content     []byte
+}
+
+// NewRawBody reads the reader into a RequestBody without a content type
+func NewRawBody(body io.Reader) (*RequestBody, error) {
+	if body == nil {
+		return &RequestBody{}, nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		err = errors.Wrap(err, "failed to read request body")
+		return nil, err
+	}
+	return &RequestBody{Data: data}, nil
+}
+
+// NewFormBody creates an url encoded form body
+func NewFormBody(values url.Values) *RequestBody {
+	return &RequestBody{
+		ContentType: ContentTypeForm,
+		Data:        []byte(values.Encode()),
+	}
+}
+
+// NewJSONBody creates a json body from the marshalled v
+func NewJSONBody(v any) (*RequestBody, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		err = errors.Wrap(err, "failed to marshal json body")
+		return nil, err
+	}
+	return &RequestBody{
+		ContentType: ContentTypeJSON,
+		Data:        data,
+	}, nil
+}
+
+// NewMultipartBody creates a multipart/form-data body from the fields and the files
+func NewMultipartBody(fields url.Values, files ...MultipartFile) (*RequestBody, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	for name, values := range fields {
+		for _, value := range values {
+			if err := w.WriteField(name, value); err != nil {
+				err = errors.Wrapf(err, "failed to write multipart field %s", name)
+				return nil, err
+			}
+		}
+	}
+	for _, file := range files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set(
+			"Content-Disposition",
+			`form-data; name="`+escapeQuotes(file.FieldName)+`"; filename="`+escapeQuotes(file.FileName)+`"`,
+		)
+		h.Set("Content-Type", contentType)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to create multipart file %s", file.FieldName)
+			return nil, err
+		}
+		if _, err = part.Write(file.Content); err != nil {
+			err = errors.Wrapf(err, "failed to write multipart file %s", file.FieldName)
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		err = errors.Wrap(err, "failed to close multipart writer")
+		return nil, err
+	}
+	return &RequestBody{
+		ContentType: w.FormDataContentType(),
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// Reader returns a new reader over the body, nil if the body is empty
+func (b *RequestBody) Reader() io.Reader {
+	if b == nil || b.Data == nil {
+		return nil
+	}
+	return bytes.NewReader(b.Data)
+}
+
+// Len returns the length of the body in bytes
+func (b *RequestBody) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.Data)
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFormBody(t *testing.T) {
+	b := NewFormBody(url.Values{"url": {"https://ve.cbi.ir/DefaultVE.aspx"}})
+	assert.Equal(t, ContentTypeForm, b.ContentType)
+	assert.Equal(t, "url=https%3A%2F%2Fve.cbi.ir%2FDefaultVE.aspx", string(b.Data))
+}
+
+func TestRequestBodyIsReReadable(t *testing.T) {
+	b, err := NewJSONBody(map[string]int{"a": 1})
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeJSON, b.ContentType)
+
+	for i := 0; i < 2; i++ {
+		data, err := io.ReadAll(b.Reader())
+		require.NoError(t, err)
+		assert.Equal(t, `{"a":1}`, string(data))
+	}
+}
+
+func TestBuildRequestSetsContentTypeAndLength(t *testing.T) {
+	b := NewFormBody(url.Values{"a": {"b"}})
+	headers := DefaultChromeHeaders.Clone()
+	headers.Set("Content-Type", "text/plain")
+
+	r, err := BuildRequest("POST", "https://example.com", headers, b)
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeForm, r.Header.Get("Content-Type"))
+	assert.Equal(t, int64(b.Len()), r.ContentLength)
+	assert.Equal(t, "text/plain", headers.Get("Content-Type"), "passed headers must not be modified")
+}
+
+func TestBuildRequestDerivesHost(t *testing.T) {
+	r, err := BuildRequest("GET", "https://api.ipify.org/", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "api.ipify.org", r.Header.Get("Host"))
+	assert.Empty(t, DefaultGetHeaders.Get("Host"), "default headers must not be modified")
+
+	headers := DefaultChromeHeaders.Clone()
+	headers.Set("Host", "ve.cbi.ir")
+	r, err = BuildRequest("GET", "https://10.0.0.1/", headers, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ve.cbi.ir", r.Host)
+	assert.Equal(t, "ve.cbi.ir", r.Header.Get("Host"))
+}
+
+func TestNewMultipartBody(t *testing.T) {
+	b, err := NewMultipartBody(
+		url.Values{"name": {"value"}},
+		MultipartFile{FieldName: "file", FileName: "a.txt", Content: []byte("content")},
+	)
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(b.ContentType)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", mediaType)
+
+	form, err := multipart.NewReader(b.Reader(), params["boundary"]).ReadForm(1 << 20)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"value"}, form.Value["name"])
+	require.Len(t, form.File["file"], 1)
+	assert.Equal(t, "a.txt", form.File["file"][0].Filename)
+	assert.Equal(t, int64(len("content")), form.File["file"][0].Size)
+}
@@ -1,5 +1,275 @@
 package util
 
-import "github.com/microcosm-cc/bluemonday"
+import (
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"net/url"
+	"strings"
+)
 
 var HtmlTagStripper = bluemonday.StripTagsPolicy()
+
+// ErrFormNotFound is returned when the page has no form with the id or name
+var ErrFormNotFound = errors.New("form not found")
+
+const (
+	// EventTarget is the hidden field of the control that caused an ASP.NET WebForms postback
+	EventTarget = "__EVENTTARGET"
+	// EventArgument is the hidden field of the argument of an ASP.NET WebForms postback
+	EventArgument = "__EVENTARGUMENT"
+)
+
+// SelectOption is an option of a select
+type SelectOption struct {
+	Value    string
+	Text     string
+	Selected bool
+}
+
+// Form is a form of a page, with the values its controls would submit
+type Form struct {
+	ID     string
+	Name   string
+	Action string
+	// Method is upper-cased, defaults to GET
+	Method string
+	// Hidden are the hidden inputs, e.g., __VIEWSTATE, __EVENTVALIDATION and __EVENTTARGET
+	Hidden url.Values
+	// Fields are the values of the enabled visible controls, the unchecked checkboxes and radios are left out
+	Fields url.Values
+	// Options are the options of the selects, by their name
+	Options map[string][]SelectOption
+	// Buttons are the submit buttons, which are only submitted when clicked, see [Form.Submit]
+	Buttons url.Values
+}
+
+// ParseForms parses the forms of the page, in their order on the page
+func ParseForms(page string) ([]*Form, error) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse html")
+	}
+	var forms []*Form
+	var walk func(n *html.Node, form *Form)
+	walk = func(n *html.Node, form *Form) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Form:
+				form = newForm(n)
+				forms = append(forms, form)
+			case atom.Input:
+				form.addInput(n)
+			case atom.Select:
+				form.addSelect(n)
+				return
+			case atom.Textarea:
+				if name := attr(n, "name"); form != nil && name != "" && !hasAttr(n, "disabled") {
+					form.Fields.Add(name, text(n))
+				}
+				return
+			case atom.Button:
+				if name := attr(n, "name"); form != nil && name != "" && !hasAttr(n, "disabled") &&
+					(attr(n, "type") == "" || strings.EqualFold(attr(n, "type"), "submit")) {
+					form.Buttons.Add(name, attr(n, "value"))
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, form)
+		}
+	}
+	walk(doc, nil)
+	return forms, nil
+}
+
+// ParseForm parses the form of the page with the id or name
+func ParseForm(page string, idOrName string) (*Form, error) {
+	forms, err := ParseForms(page)
+	if err != nil {
+		return nil, err
+	}
+	for _, form := range forms {
+		if form.ID == idOrName || form.Name == idOrName {
+			return form, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrFormNotFound, "no form %q", idOrName)
+}
+
+func newForm(n *html.Node) *Form {
+	method := strings.ToUpper(attr(n, "method"))
+	if method == "" {
+		method = "GET"
+	}
+	return &Form{
+		ID:      attr(n, "id"),
+		Name:    attr(n, "name"),
+		Action:  attr(n, "action"),
+		Method:  method,
+		Hidden:  url.Values{},
+		Fields:  url.Values{},
+		Options: map[string][]SelectOption{},
+		Buttons: url.Values{},
+	}
+}
+
+func (f *Form) addInput(n *html.Node) {
+	name := attr(n, "name")
+	if f == nil || name == "" || hasAttr(n, "disabled") {
+		return
+	}
+	value := attr(n, "value")
+	switch strings.ToLower(attr(n, "type")) {
+	case "hidden":
+		f.Hidden.Add(name, value)
+	case "checkbox", "radio":
+		if hasAttr(n, "checked") {
+			if value == "" {
+				value = "on"
+			}
+			f.Fields.Add(name, value)
+		}
+	case "submit", "image":
+		f.Buttons.Add(name, value)
+	case "button", "reset", "file":
+	default:
+		f.Fields.Add(name, value)
+	}
+}
+
+func (f *Form) addSelect(n *html.Node) {
+	name := attr(n, "name")
+	if f == nil || name == "" {
+		return
+	}
+	var options []SelectOption
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Option {
+			option := SelectOption{Text: strings.TrimSpace(text(n)), Selected: hasAttr(n, "selected")}
+			option.Value = option.Text
+			if hasAttr(n, "value") {
+				option.Value = attr(n, "value")
+			}
+			options = append(options, option)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	f.Options[name] = options
+	if hasAttr(n, "disabled") {
+		return
+	}
+
+	multiple := hasAttr(n, "multiple")
+	selected := false
+	for _, option := range options {
+		if option.Selected {
+			f.Fields.Add(name, option.Value)
+			selected = true
+			if !multiple {
+				break
+			}
+		}
+	}
+	// A single select submits its first option when none is selected
+	if !selected && !multiple && len(options) > 0 {
+		f.Fields.Add(name, options[0].Value)
+	}
+}
+
+// values returns a copy of the hidden and the field values
+func (f *Form) values() url.Values {
+	values := url.Values{}
+	for k, vs := range f.Hidden {
+		values[k] = append([]string(nil), vs...)
+	}
+	for k, vs := range f.Fields {
+		values[k] = append(values[k], vs...)
+	}
+	return values
+}
+
+// Postback returns the values of an ASP.NET WebForms postback caused by the control eventTarget,
+// i.e., what __doPostBack(eventTarget, eventArgument) submits, the overrides replace the values of the form
+func (f *Form) Postback(eventTarget string, eventArgument string, overrides url.Values) url.Values {
+	values := f.values()
+	values.Set(EventTarget, eventTarget)
+	values.Set(EventArgument, eventArgument)
+	for k, vs := range overrides {
+		values[k] = append([]string(nil), vs...)
+	}
+	return values
+}
+
+// PostbackBody returns the form body of the [Form.Postback]
+func (f *Form) PostbackBody(eventTarget string, eventArgument string, overrides url.Values) *RequestBody {
+	return NewFormBody(f.Postback(eventTarget, eventArgument, overrides))
+}
+
+// Submit returns the values of submitting the form by clicking the button, an empty button submits it without one
+func (f *Form) Submit(button string, overrides url.Values) (url.Values, error) {
+	values := f.values()
+	if button != "" {
+		value, ok := f.Buttons[button]
+		if !ok {
+			return nil, errors.Errorf("form has no button %q", button)
+		}
+		values[button] = append([]string(nil), value[:1]...)
+	}
+	if _, ok := values[EventTarget]; ok {
+		values.Set(EventTarget, "")
+		values.Set(EventArgument, "")
+	}
+	for k, vs := range overrides {
+		values[k] = append([]string(nil), vs...)
+	}
+	return values, nil
+}
+
+// ActionURL resolves the action of the form against the url of the page, an empty action posts to the page
+func (f *Form) ActionURL(page *url.URL) (*url.URL, error) {
+	u, err := page.Parse(f.Action)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse form action")
+	}
+	return u, nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func text(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
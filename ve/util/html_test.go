@@ -0,0 +1,83 @@
+package util
+
+import (
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadWebForm(t *testing.T) string {
+	page, err := os.ReadFile("testdata/webform.html")
+	require.NoError(t, err)
+	return string(page)
+}
+
+func TestParseForms(t *testing.T) {
+	forms, err := ParseForms(loadWebForm(t))
+	require.NoError(t, err)
+	require.Len(t, forms, 2)
+	assert.Equal(t, "search", forms[0].ID)
+	assert.Equal(t, "GET", forms[0].Method)
+	assert.Equal(t, url.Values{"q": {""}}, forms[0].Fields)
+
+	form := forms[1]
+	assert.Equal(t, "POST", form.Method)
+	assert.Equal(t, "/wEdAAYlcbu0pJ3i+Q5S4ir1w7AQ&x", form.Hidden.Get("__EVENTVALIDATION"))
+	assert.Equal(t, "C2EE9ABB", form.Hidden.Get("__VIEWSTATEGENERATOR"))
+	assert.Contains(t, form.Hidden, EventTarget)
+	assert.Equal(
+		t, url.Values{
+			"ctl00$txtNationalCode": {"0012345678"},
+			"ctl00$txtPassword":     {""},
+			"ctl00$ddlProvince":     {"8"},
+			"ctl00$ddlCity":         {"0"},
+			"ctl00$gender":          {"rbMale"},
+			"ctl00$chkSms":          {"on"},
+			"ctl00$txtAddress":      {"خیابان آزادی"},
+		}, form.Fields,
+	)
+	assert.Equal(t, url.Values{"ctl00$btnSubmit": {"ثبت"}, "ctl00$btnCancel": {"انصراف"}}, form.Buttons)
+	require.Len(t, form.Options["ctl00$ddlProvince"], 3)
+	assert.Equal(t, SelectOption{Value: "8", Text: "تهران", Selected: true}, form.Options["ctl00$ddlProvince"][1])
+	assert.Len(t, form.Options["ctl00$ddlBank"], 1)
+
+	action, err := form.ActionURL(&url.URL{Scheme: "https", Host: "ve.cbi.ir", Path: "/app/DefaultVE.aspx"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://ve.cbi.ir/app/DefaultVE.aspx?lang=fa", action.String())
+
+	_, err = ParseForm(loadWebForm(t), "missing")
+	assert.ErrorIs(t, err, ErrFormNotFound)
+}
+
+func TestFormPostback(t *testing.T) {
+	form, err := ParseForm(loadWebForm(t), "form1")
+	require.NoError(t, err)
+
+	values := form.Postback("ctl00$ddlProvince", "", url.Values{"ctl00$ddlProvince": {"3"}})
+	assert.Equal(t, "ctl00$ddlProvince", values.Get(EventTarget))
+	assert.Equal(t, "", values.Get(EventArgument))
+	assert.Equal(t, []string{"3"}, values["ctl00$ddlProvince"])
+	assert.Equal(t, form.Hidden.Get("__VIEWSTATE"), values.Get("__VIEWSTATE"))
+	assert.NotContains(t, values, "ctl00$btnSubmit", "buttons are not submitted by a postback")
+	assert.NotContains(t, values, "ctl00$txtTracking", "disabled inputs are not submitted")
+	assert.Equal(t, "8", form.Fields.Get("ctl00$ddlProvince"), "the form must not be modified")
+
+	body := form.PostbackBody("ctl00$lnkNext", "", nil)
+	assert.Equal(t, ContentTypeForm, body.ContentType)
+	parsed, err := url.ParseQuery(string(body.Data))
+	require.NoError(t, err)
+	assert.Equal(t, "ctl00$lnkNext", parsed.Get(EventTarget))
+
+	values, err = form.Submit("ctl00$btnSubmit", url.Values{"ctl00$txtPassword": {"secret"}})
+	require.NoError(t, err)
+	assert.Equal(t, "ثبت", values.Get("ctl00$btnSubmit"))
+	assert.NotContains(t, values, "ctl00$btnCancel")
+	assert.Equal(t, "secret", values.Get("ctl00$txtPassword"))
+	assert.Equal(t, "", values.Get(EventTarget))
+
+	_, err = form.Submit("ctl00$missing", nil)
+	assert.Error(t, err)
+}
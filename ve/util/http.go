@@ -21,7 +21,6 @@ var DefaultChromeHeaders = http.Header{
 	"Accept-Language":           {`en-US,en;q=0.9`},
 	"Cache-Control":             {`max-age=0`},
 	"Connection":                {`keep-alive`},
-	"Host":                      {`ve.cbi.ir`},
 	"Referer":                   {"https://www.google.com/"},
 	"Sec-Fetch-Dest":            {`document`},
 	"Sec-Fetch-Mode":            {`navigate`},
@@ -74,9 +73,16 @@ var DefaultGoogleBotHeaders = http.Header{
 
 func GetRequest(ctx context.Context, client tls_client.HttpClient, r *http.Request) (
 	resp *http.Response, body string, err error,
+) {
+	return DoRequest(ctx, client.Do, r)
+}
+
+// DoRequest sends the request via do and reads the whole response body
+func DoRequest(ctx context.Context, do DoFunc, r *http.Request) (
+	resp *http.Response, body string, err error,
 ) {
 	r = r.WithContext(ctx)
-	resp, err = client.Do(r)
+	resp, err = do(r)
 	if err != nil {
 		err = errors.Wrap(err, "failed to get request")
 		return
@@ -127,3 +133,30 @@ func BuildPostRequest(url string, headers http.Header, requestBody io.Reader) (r
 	r.Header = headers
 	return
 }
+
+// BuildRequest creates a request of any method with a re-readable body
+//
+// The Content-Type header is set from the body when it has one.
+// The Host header is set from the url, unless the headers override it.
+func BuildRequest(method string, url string, headers http.Header, body *RequestBody) (r *http.Request, err error) {
+	if headers == nil {
+		headers = DefaultGetHeaders
+	}
+	headers = headers.Clone()
+	r, err = http.NewRequest(method, url, body.Reader())
+	if err != nil {
+		err = errors.Wrap(err, "failed to create http request")
+		return
+	}
+
+	if body != nil && body.ContentType != "" {
+		headers.Set("Content-Type", body.ContentType)
+	}
+	if host := headers.Get("Host"); host != "" {
+		r.Host = host
+	} else {
+		headers.Set("Host", r.URL.Host)
+	}
+	r.Header = headers
+	return
+}
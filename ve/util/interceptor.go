@@ -0,0 +1,23 @@
+package util
+
+import (
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// DoFunc sends the request and returns its response
+type DoFunc func(req *http.Request) (*http.Response, error)
+
+// Interceptor wraps sending a request, it must call next to pass the request onwards,
+// or it may return a response of its own without calling next
+type Interceptor func(req *http.Request, next DoFunc) (*http.Response, error)
+
+// ChainInterceptors wraps do with the interceptors, the first interceptor is the outermost one
+func ChainInterceptors(do DoFunc, interceptors ...Interceptor) DoFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], do
+		do = func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, next)
+		}
+	}
+	return do
+}
@@ -0,0 +1,232 @@
+package regex
+
+import (
+	"encoding"
+	"github.com/pkg/errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tag is the struct tag naming the capture group of a field, e.g., `regex:"year"`
+//
+// The layout of a time.Time field defaults to time.RFC3339 and is set via the layout tag,
+// e.g., `regex:"date" layout:"2006-01-02"`. The fields without the tag, or tagged "-", are left as is.
+const Tag = "regex"
+
+// LayoutTag is the struct tag of the layout of a time.Time field
+const LayoutTag = "layout"
+
+// ErrNoMatch is returned by [Extract] when the regular expression doesn't match
+var ErrNoMatch = errors.New("no match")
+
+var (
+	// patterns are the compiled patterns, by their source
+	patterns sync.Map
+	// plans are the fields of the struct types, by their type
+	plans sync.Map
+
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Compile returns the compiled pattern, compiling it only the first time
+func Compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to compile %q", pattern)
+	}
+	actual, _ := patterns.LoadOrStore(pattern, re)
+	return actual.(*regexp.Regexp), nil
+}
+
+// MustCompile is like Compile but panics if the pattern can't be compiled
+func MustCompile(pattern string) *regexp.Regexp {
+	re, err := Compile(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// field is a tagged field of a struct
+type field struct {
+	name   string
+	index  []int
+	group  string
+	layout string
+}
+
+// fieldsOf returns the tagged fields of the struct type t
+func fieldsOf(t reflect.Type) ([]field, error) {
+	if fields, ok := plans.Load(t); ok {
+		return fields.([]field), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, errors.Errorf("%s is not a struct", t)
+	}
+	var fields []field
+	for _, f := range reflect.VisibleFields(t) {
+		group, ok := f.Tag.Lookup(Tag)
+		if !ok || group == "-" || !f.IsExported() {
+			continue
+		}
+		layout := f.Tag.Get(LayoutTag)
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		fields = append(fields, field{name: f.Name, index: f.Index, group: group, layout: layout})
+	}
+	plans.Store(t, fields)
+	return fields, nil
+}
+
+// Extract fills a T from the named capture groups of the leftmost match of the regular expression in s
+//
+// T must be a struct, see [Tag] on how its fields are tagged. ErrNoMatch is returned when there's no match.
+func Extract[T any](regEx *regexp.Regexp, s string) (T, error) {
+	return ExtractWith[T](nil, regEx, s)
+}
+
+// ExtractWith is like Extract, but applies the ManipulateStringResult of c to every field
+func ExtractWith[T any](c *Regex, regEx *regexp.Regexp, s string) (T, error) {
+	var v T
+	match := regEx.FindStringSubmatchIndex(s)
+	if match == nil {
+		return v, ErrNoMatch
+	}
+	err := c.fill(&v, regEx, s, match)
+	return v, err
+}
+
+// ExtractAll is like Extract, but fills a T for each of the successive matches, n < 0 means all matches
+//
+// A return value of nil indicates no match.
+func ExtractAll[T any](regEx *regexp.Regexp, s string, n int) ([]T, error) {
+	return ExtractAllWith[T](nil, regEx, s, n)
+}
+
+// ExtractAllWith is like ExtractAll, but applies the ManipulateStringResult of c to every field
+func ExtractAllWith[T any](c *Regex, regEx *regexp.Regexp, s string, n int) ([]T, error) {
+	matches := regEx.FindAllStringSubmatchIndex(s, n)
+	if matches == nil {
+		return nil, nil
+	}
+	r := make([]T, len(matches))
+	for i, match := range matches {
+		if err := c.fill(&r[i], regEx, s, match); err != nil {
+			return nil, errors.Wrapf(err, "match %d", i)
+		}
+	}
+	return r, nil
+}
+
+// fill sets the tagged fields of the struct v points to from the groups of the match
+func (c *Regex) fill(v any, regEx *regexp.Regexp, s string, match []int) error {
+	rv := reflect.ValueOf(v).Elem()
+	fields, err := fieldsOf(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		i := regEx.SubexpIndex(f.group)
+		if i < 0 {
+			return errors.Errorf("%s has no group %q of field %s", regEx, f.group, f.name)
+		}
+		// A group which didn't participate in the match is a nil
+		var result *string
+		if match[2*i] >= 0 {
+			group := s[match[2*i]:match[2*i+1]]
+			result = &group
+		}
+		if c != nil && c.options.ManipulateStringResult != nil {
+			result = c.options.ManipulateStringResult(result)
+		}
+		if result == nil {
+			continue
+		}
+		if err = set(rv.FieldByIndex(f.index), *result, f.layout); err != nil {
+			return errors.Wrapf(err, "failed to set field %s from group %q", f.name, f.group)
+		}
+	}
+	return nil
+}
+
+// set converts s to the type of v and sets it, an empty s leaves the non-string values as is
+//
+// The thousands separators of the numbers are dropped, e.g., 1,250 is 1250.
+func set(v reflect.Value, s string, layout string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.Type().Elem().Kind() != reflect.String && strings.TrimSpace(s) == "" {
+			return nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		if err := set(elem.Elem(), s, layout); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(s)
+		return nil
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	switch {
+	case v.Type() == timeType:
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(strings.ReplaceAll(s, ",", ""), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(strings.ReplaceAll(s, ",", ""), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return errors.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package regex
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type appointment struct {
+	ID       int       `regex:"id"`
+	Center   string    `regex:"center"`
+	Date     time.Time `regex:"date" layout:"02/01/2006"`
+	Slots    *uint     `regex:"slots"`
+	Open     bool      `regex:"open"`
+	Fee      float64   `regex:"fee"`
+	Note     *string   `regex:"note"`
+	Internal string
+}
+
+const rows = `<tr data-id="12"><td> Tehran </td><td>05/11/2026</td><td>1,250</td><td>true</td><td>40.5</td></tr>
+<tr data-id="13"><td>Shiraz</td><td>06/11/2026</td><td></td><td>false</td><td>0</td><td>late</td></tr>`
+
+var rowRegex = MustCompile(
+	`<tr data-id="(?P<id>\d+)"><td>(?P<center>[^<]*)</td><td>(?P<date>[^<]*)</td><td>(?P<slots>[^<]*)</td>` +
+		`<td>(?P<open>[^<]*)</td><td>(?P<fee>[^<]*)</td>(?:<td>(?P<note>[^<]*)</td>)?</tr>`,
+)
+
+func TestExtract(t *testing.T) {
+	a, err := Extract[appointment](rowRegex, rows)
+	require.NoError(t, err)
+	slots := uint(1250)
+	assert.Equal(
+		t, appointment{
+			ID:     12,
+			Center: " Tehran ",
+			Date:   time.Date(2026, 11, 5, 0, 0, 0, 0, time.UTC),
+			Slots:  &slots,
+			Open:   true,
+			Fee:    40.5,
+		}, a,
+	)
+
+	_, err = Extract[appointment](rowRegex, "no rows")
+	assert.ErrorIs(t, err, ErrNoMatch)
+
+	_, err = Extract[struct {
+		Missing string `regex:"missing"`
+	}](rowRegex, rows)
+	assert.ErrorContains(t, err, `no group "missing"`)
+
+	_, err = Extract[struct {
+		ID bool `regex:"id"`
+	}](rowRegex, rows)
+	assert.ErrorContains(t, err, "failed to set field ID")
+}
+
+func TestExtractAllWith(t *testing.T) {
+	r := New(
+		&Options{
+			ManipulateStringResult: func(result *string) *string {
+				if result == nil {
+					return nil
+				}
+				trimmed := strings.TrimSpace(*result)
+				return &trimmed
+			},
+		},
+	)
+	all, err := ExtractAllWith[appointment](r, rowRegex, rows, -1)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "Tehran", all[0].Center, "the hook applies per field")
+	assert.Nil(t, all[0].Note, "the group didn't participate in the match")
+	assert.Nil(t, all[1].Slots, "the group is empty")
+	assert.False(t, all[1].Open)
+	require.NotNil(t, all[1].Note)
+	assert.Equal(t, "late", *all[1].Note)
+
+	none, err := ExtractAll[appointment](rowRegex, "no rows", -1)
+	require.NoError(t, err)
+	assert.Nil(t, none)
+}
+
+func TestCompile(t *testing.T) {
+	re, err := Compile(`\d+`)
+	require.NoError(t, err)
+	assert.Same(t, re, MustCompile(`\d+`))
+
+	_, err = Compile(`(`)
+	assert.Error(t, err)
+	assert.Panics(t, func() { MustCompile(`(`) })
+}
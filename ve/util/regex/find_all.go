@@ -1,7 +1,7 @@
 package regex
 
 import (
-	"github.com/Dissociable/IPFA/ipfc/services/util"
+	"github.com/Dissociable/Couploan/ve/util"
 	"regexp"
 )
 
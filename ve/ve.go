@@ -1,8 +1,10 @@
 package ve
 
 import (
+	"context"
 	"github.com/Dissociable/Couploan/config"
 	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve/httpcache"
 	tls_client "github.com/bogdanfinn/tls-client"
 )
 
@@ -10,8 +12,14 @@ type VE struct {
 	ps                *proxstore.ProxStore[tls_client.HttpClient]
 	proxy             *proxstore.Proxy[tls_client.HttpClient]
 	cj                *CookieJar
+	cookieJars        *CookieJarSessions
 	config            *config.Config
+	target            *TargetProfile
 	shapeSolverClient tls_client.HttpClient
+	circuitBreaker    *CircuitBreaker
+	responseCache     *httpcache.Cache
+	ipResolver        IPResolver
+	geoIP             *GeoIP
 }
 
 func New(
@@ -35,3 +43,85 @@ func New(
 		shapeSolverClient: shapeSolverClient,
 	}
 }
+
+// SetTarget sets the profile of the target of the session, defaults to TargetProfileVE
+func (ve *VE) SetTarget(target *TargetProfile) *VE {
+	ve.target = target
+	return ve
+}
+
+// Target returns the profile of the target of the session
+func (ve *VE) Target() *TargetProfile {
+	if ve.target == nil {
+		return TargetProfileVE
+	}
+	return ve.target
+}
+
+// SetCookieJar replaces the cookie jar of the session, e.g., with one from [CookieJarSessions]
+func (ve *VE) SetCookieJar(cj *CookieJar) *VE {
+	ve.cj = cj
+	return ve
+}
+
+// SetSessionID replaces the cookie jar of the session with the persisted jar of the session id, so its cookies
+// survive restarts, see [CookieJarSessions]
+func (ve *VE) SetSessionID(ctx context.Context, cookieJars *CookieJarSessions, sessionID string) error {
+	cj, err := cookieJars.Get(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	ve.cj = cj
+	ve.cookieJars = cookieJars
+	return nil
+}
+
+// SessionID returns the id of the session, empty if its cookie jar isn't persisted
+func (ve *VE) SessionID() string {
+	return ve.cj.SessionID
+}
+
+// SaveCookieJar saves the cookie jar of the session when it's persisted, see [VE.SetSessionID]
+func (ve *VE) SaveCookieJar(ctx context.Context) error {
+	if ve.cookieJars == nil || ve.cj.SessionID == "" {
+		return nil
+	}
+	return ve.cookieJars.Save(ctx, ve.cj.SessionID)
+}
+
+// DeleteCookieJar deletes the persisted cookie jar of the session, e.g., once its cookies are burnt
+func (ve *VE) DeleteCookieJar(ctx context.Context) error {
+	if ve.cookieJars == nil || ve.cj.SessionID == "" {
+		return nil
+	}
+	return ve.cookieJars.Delete(ctx, ve.cj.SessionID)
+}
+
+// CookieJar returns the cookie jar of the session
+func (ve *VE) CookieJar() *CookieJar {
+	return ve.cj
+}
+
+// SetCircuitBreaker sets the circuit breaker shared by the requests of the session, nil disables it
+func (ve *VE) SetCircuitBreaker(cb *CircuitBreaker) *VE {
+	ve.circuitBreaker = cb
+	return ve
+}
+
+// SetResponseCache sets the cache of the idempotent lookups of the session, e.g., [VE.Index], nil disables it
+func (ve *VE) SetResponseCache(responseCache *httpcache.Cache) *VE {
+	ve.responseCache = responseCache
+	return ve
+}
+
+// SetIPResolver sets the resolver of the exit ip, defaults to an [EchoIPResolver] over all the known endpoints
+func (ve *VE) SetIPResolver(resolver IPResolver) *VE {
+	ve.ipResolver = resolver
+	return ve
+}
+
+// SetGeoIP sets the databases enriching the exits with their country and ASN, nil disables it
+func (ve *VE) SetGeoIP(geoIP *GeoIP) *VE {
+	ve.geoIP = geoIP
+	return ve
+}
@@ -0,0 +1,47 @@
+package ve
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve/har"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newReplayVE creates a VE whose proxy serves the responses recorded in testdata/ve.har
+func newReplayVE(t *testing.T, mode har.MatchMode) (*VE, *har.Client) {
+	client, err := har.NewClientFromFile("testdata/ve.har", mode)
+	require.NoError(t, err)
+
+	proxy := proxstore.NewProxy[tls_client.HttpClient]("127.0.0.1", 8080, proxstore.ProtocolHttp)
+	proxy.SetHttpClient(client, "ve")
+	cj, err := NewCookieJar(&CookieJarOptions{Options: nil})
+	require.NoError(t, err)
+
+	return &VE{proxy: proxy, cj: cj}, client
+}
+
+func TestVE_IP(t *testing.T) {
+	v, client := newReplayVE(t, har.MatchStrict)
+
+	ip, err := v.IP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.7", ip)
+	assert.Equal(t, 1, client.Remaining())
+}
+
+func TestVE_Index(t *testing.T) {
+	v, _ := newReplayVE(t, har.MatchLenient)
+
+	body, err := v.Index(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, body, `id="form1"`)
+
+	cookies := v.cj.Cookies(&url.URL{Scheme: "https", Host: "ve.cbi.ir", Path: "/"})
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "ASP.NET_SessionId", cookies[0].Name)
+}
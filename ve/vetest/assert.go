@@ -0,0 +1,51 @@
+package vetest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// AssertCalls asserts that the client received n calls
+func (c *Client) AssertCalls(t testing.TB, n int) bool {
+	t.Helper()
+	return assert.Len(t, c.Calls(), n, "number of calls")
+}
+
+// AssertHeader asserts that the i-th call, starting from 0, had the header with the value
+func (c *Client) AssertHeader(t testing.TB, i int, name string, value string) bool {
+	t.Helper()
+	call, ok := c.call(t, i)
+	return ok && assert.Equal(t, value, call.Header.Get(name), "header %s of call %d", name, i)
+}
+
+// AssertCookie asserts that the i-th call, starting from 0, sent the cookie with the value
+func (c *Client) AssertCookie(t testing.TB, i int, name string, value string) bool {
+	t.Helper()
+	call, ok := c.call(t, i)
+	if !ok {
+		return false
+	}
+	for _, cookie := range call.Cookies {
+		if cookie.Name == name {
+			return assert.Equal(t, value, cookie.Value, "cookie %s of call %d", name, i)
+		}
+	}
+	return assert.Fail(t, "cookie not sent", "call %d sent no cookie %s", i, name)
+}
+
+// AssertProxy asserts that the i-th call, starting from 0, was sent through the proxy url
+func (c *Client) AssertProxy(t testing.TB, i int, proxyURL string) bool {
+	t.Helper()
+	call, ok := c.call(t, i)
+	return ok && assert.Equal(t, proxyURL, call.Proxy, "proxy of call %d", i)
+}
+
+func (c *Client) call(t testing.TB, i int) (Call, bool) {
+	t.Helper()
+	calls := c.Calls()
+	if !assert.Less(t, i, len(calls), "call %d was not made", i) {
+		return Call{}, false
+	}
+	return calls[i], true
+}
@@ -0,0 +1,375 @@
+// Package vetest provides a scriptable in-memory [tls_client.HttpClient] for testing the code built on
+// ve.Requester and proxstore.Proxy without network access
+package vetest
+
+import (
+	"fmt"
+	"github.com/Dissociable/Couploan/proxstore"
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/bandwidth"
+	"github.com/pkg/errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoResponse is returned when no route matches the request and there's no default response
+var ErrNoResponse = errors.New("no canned response for the request")
+
+// Response is a canned response of the client
+type Response struct {
+	// StatusCode defaults to 200
+	StatusCode int
+	Header     http.Header
+	Body       string
+	// Err is returned by Do instead of the response, e.g., to simulate a proxy or a timeout error
+	Err error
+	// Latency delays the response, the delay is cut short when the context of the request is done
+	Latency time.Duration
+}
+
+// OK returns a 200 response with the body
+func OK(body string) Response {
+	return Response{StatusCode: http.StatusOK, Body: body}
+}
+
+// Status returns a response with the status code and the body
+func Status(statusCode int, body string) Response {
+	return Response{StatusCode: statusCode, Body: body}
+}
+
+// Fail returns a response failing with err
+func Fail(err error) Response {
+	return Response{Err: err}
+}
+
+// Call is a request received by the client
+type Call struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+	// Cookies are the cookies sent with the request, including the ones of the cookie jar
+	Cookies []*http.Cookie
+	// Proxy is the proxy url set on the client via SetProxy when the call was made
+	Proxy string
+	At    time.Time
+}
+
+// route serves its responses in order, the last one is served again once they run out
+type route struct {
+	match     func(req *http.Request, proxy string) bool
+	responses []Response
+	next      int
+}
+
+func (r *route) response() Response {
+	resp := r.responses[r.next]
+	if r.next < len(r.responses)-1 {
+		r.next++
+	}
+	return resp
+}
+
+// state is shared by the client and its views of [Client.ForProxy]
+type state struct {
+	mu       sync.Mutex
+	routes   []*route
+	fallback *Response
+	latency  time.Duration
+	calls    []Call
+}
+
+// Client is a fake [tls_client.HttpClient] serving canned responses and recording the calls
+type Client struct {
+	*state
+	mu             sync.Mutex
+	jar            http.CookieJar
+	proxy          string
+	followRedirect bool
+}
+
+// NewClient creates a client without any routes, every request fails with ErrNoResponse until some are added
+func NewClient() *Client {
+	return &Client{state: &state{}}
+}
+
+// ForProxy returns a client sharing the routes and the calls of c, with its proxy url set to proxyURL
+func (c *Client) ForProxy(proxyURL string) *Client {
+	return &Client{state: c.state, proxy: proxyURL}
+}
+
+// Proxy sets the http client creator of the proxy to one returning a view of c for the proxy
+func (c *Client) Proxy(proxy *proxstore.Proxy[tls_client.HttpClient]) *proxstore.Proxy[tls_client.HttpClient] {
+	return proxy.SetHttpClientCreator(
+		func(proxy *proxstore.Proxy[tls_client.HttpClient]) (tls_client.HttpClient, error) {
+			return c.ForProxy(proxy.String()), nil
+		},
+	)
+}
+
+// On adds the responses of the requests with the method to the url, an empty method matches any method
+//
+// The url matches the requests regardless of their query, unless it has a query itself.
+func (c *Client) On(method string, link string, responses ...Response) *Client {
+	return c.on(
+		func(req *http.Request, _ string) bool {
+			return (method == "" || strings.EqualFold(method, req.Method)) && urlMatches(link, req.URL)
+		}, responses,
+	)
+}
+
+// OnProxy is like On, but only matches the requests sent through the proxy url
+func (c *Client) OnProxy(proxyURL string, method string, link string, responses ...Response) *Client {
+	return c.on(
+		func(req *http.Request, proxy string) bool {
+			return proxy == proxyURL &&
+				(method == "" || strings.EqualFold(method, req.Method)) && urlMatches(link, req.URL)
+		}, responses,
+	)
+}
+
+// OnFunc adds the responses of the requests match returns true for
+func (c *Client) OnFunc(match func(req *http.Request) bool, responses ...Response) *Client {
+	return c.on(func(req *http.Request, _ string) bool { return match(req) }, responses)
+}
+
+func (c *Client) on(match func(req *http.Request, proxy string) bool, responses []Response) *Client {
+	if len(responses) == 0 {
+		responses = []Response{OK("")}
+	}
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	c.routes = append(c.routes, &route{match: match, responses: responses})
+	return c
+}
+
+// SetDefault sets the response of the requests no route matches
+func (c *Client) SetDefault(resp Response) *Client {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	c.fallback = &resp
+	return c
+}
+
+// SetLatency delays every response by latency, on top of the Latency of the response
+func (c *Client) SetLatency(latency time.Duration) *Client {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	c.latency = latency
+	return c
+}
+
+// Calls returns the calls received so far, oldest first
+func (c *Client) Calls() []Call {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+// CallCount returns the number of the calls with the method to the url, matched as in On
+func (c *Client) CallCount(method string, link string) int {
+	n := 0
+	for _, call := range c.Calls() {
+		u, err := url.Parse(call.URL)
+		if err == nil && (method == "" || strings.EqualFold(method, call.Method)) && urlMatches(link, u) {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset forgets the calls, the routes are kept and served from their first response again
+func (c *Client) Reset() {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	c.calls = nil
+	for _, r := range c.routes {
+		r.next = 0
+	}
+}
+
+func urlMatches(link string, u *url.URL) bool {
+	expected, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(expected.Scheme, u.Scheme) || !strings.EqualFold(expected.Host, u.Host) ||
+		strings.TrimSuffix(expected.Path, "/") != strings.TrimSuffix(u.Path, "/") {
+		return false
+	}
+	return expected.RawQuery == "" || expected.Query().Encode() == u.Query().Encode()
+}
+
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			err = errors.Wrap(err, "failed to read request body")
+			return nil, err
+		}
+		_ = req.Body.Close()
+	}
+	cookies := req.Cookies()
+	if jar := c.GetCookieJar(); jar != nil {
+		cookies = append(cookies, jar.Cookies(req.URL)...)
+	}
+	proxy := c.GetProxy()
+
+	c.state.mu.Lock()
+	c.calls = append(
+		c.calls, Call{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Header:  req.Header.Clone(),
+			Body:    body,
+			Cookies: cookies,
+			Proxy:   proxy,
+			At:      time.Now(),
+		},
+	)
+	var canned *Response
+	for _, r := range c.routes {
+		if r.match(req, proxy) {
+			resp := r.response()
+			canned = &resp
+			break
+		}
+	}
+	if canned == nil {
+		canned = c.fallback
+	}
+	latency := c.latency
+	c.state.mu.Unlock()
+
+	if canned == nil {
+		return nil, errors.Wrapf(ErrNoResponse, "%s %s", req.Method, req.URL.String())
+	}
+	if latency += canned.Latency; latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+	if canned.Err != nil {
+		return nil, canned.Err
+	}
+
+	statusCode := canned.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        canned.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(canned.Body)),
+		ContentLength: int64(len(canned.Body)),
+		Request:       req,
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(canned.Body)))
+	if jar := c.GetCookieJar(); jar != nil {
+		if cookies := resp.Cookies(); len(cookies) > 0 {
+			jar.SetCookies(req.URL, cookies)
+		}
+	}
+	return resp, nil
+}
+
+func (c *Client) GetCookies(u *url.URL) []*http.Cookie {
+	jar := c.GetCookieJar()
+	if jar == nil {
+		return nil
+	}
+	return jar.Cookies(u)
+}
+
+func (c *Client) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	jar := c.GetCookieJar()
+	if jar == nil {
+		return
+	}
+	jar.SetCookies(u, cookies)
+}
+
+func (c *Client) SetCookieJar(jar http.CookieJar) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jar = jar
+}
+
+func (c *Client) GetCookieJar() http.CookieJar {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.jar
+}
+
+func (c *Client) SetProxy(proxyUrl string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.proxy = proxyUrl
+	return nil
+}
+
+func (c *Client) GetProxy() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.proxy
+}
+
+func (c *Client) SetFollowRedirect(followRedirect bool) {
+	c.followRedirect = followRedirect
+}
+
+func (c *Client) GetFollowRedirect() bool {
+	return c.followRedirect
+}
+
+func (c *Client) CloseIdleConnections() {}
+
+func (c *Client) Get(url string) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *Client) Head(url string) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *Client) Post(url, contentType string, body io.Reader) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req)
+}
+
+func (c *Client) GetBandwidthTracker() bandwidth.BandwidthTracker {
+	return bandwidth.NewNopeTracker()
+}
+
+// Ensure interface compatibility
+var _ tls_client.HttpClient = (*Client)(nil)
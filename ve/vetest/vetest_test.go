@@ -0,0 +1,98 @@
+package vetest
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Dissociable/Couploan/proxstore"
+	"github.com/Dissociable/Couploan/ve"
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const link = "https://example.com/page"
+
+func getClient(r *ve.Requester[any]) (tls_client.HttpClient, error) {
+	return r.GetProxy().GetHttpClient("ve"), nil
+}
+
+// TestClientRetriesOnAnotherProxy switches to the second proxy after the first one fails
+func TestClientRetriesOnAnotherProxy(t *testing.T) {
+	c := NewClient()
+	first := c.Proxy(proxstore.NewProxy[tls_client.HttpClient]("127.0.0.1", 8080, proxstore.ProtocolHttp))
+	second := c.Proxy(proxstore.NewProxy[tls_client.HttpClient]("127.0.0.2", 8080, proxstore.ProtocolHttp))
+	c.OnProxy(first.String(), "GET", link, Fail(errors.New("proxyconnect tcp: connection refused")))
+	c.On("GET", link, OK("hello"))
+
+	jar, err := ve.NewCookieJar(&ve.CookieJarOptions{})
+	require.NoError(t, err)
+	u, _ := url.Parse(link)
+	jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "abc"}})
+
+	r := ve.NewRequest[any](nil, "GET", link).
+		SetGetClientFunc(getClient).
+		SetCookieJar(jar).
+		SetProxy(first).
+		SetRetry().
+		SetMaxRetries(1)
+	r.SetRetryCheck(
+		func(requester *ve.Requester[any], resp *http.Response, respBody *string, err error) bool {
+			if errors.Is(err, ve.ErrProxy) {
+				_ = requester.ReSetProxy(second)
+				return true
+			}
+			return false
+		},
+	)
+	_, body, err := r.Do()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", body)
+
+	c.AssertCalls(t, 2)
+	c.AssertProxy(t, 0, first.String())
+	c.AssertProxy(t, 1, second.String())
+	c.AssertHeader(t, 1, "Host", "example.com")
+	c.AssertCookie(t, 1, "session", "abc")
+	assert.Equal(t, 2, c.CallCount("GET", link))
+}
+
+func TestClientResponses(t *testing.T) {
+	c := NewClient().
+		On("", link, Status(503, "down"), OK("up")).
+		SetDefault(Status(404, "not found"))
+
+	statuses := func(links ...string) (codes []int) {
+		for _, l := range links {
+			resp, err := c.Get(l)
+			require.NoError(t, err)
+			codes = append(codes, resp.StatusCode)
+		}
+		return
+	}
+	assert.Equal(t, []int{503, 200, 200, 404}, statuses(link, link+"?a=1", link, "https://example.com/other"))
+
+	c.Reset()
+	assert.Empty(t, c.Calls())
+	assert.Equal(t, []int{503}, statuses(link))
+
+	_, err := NewClient().Get(link)
+	assert.ErrorIs(t, err, ErrNoResponse)
+}
+
+func TestClientLatency(t *testing.T) {
+	c := NewClient().On("GET", link, Response{Body: "slow", Latency: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = c.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}